@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// resultSchema is the schema of the Arrow and Parquet outputs. Stddev
+// and percentiles are not included, the stats keep only min, sum, max
+// and count.
+var resultSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "station", Type: arrow.BinaryTypes.String},
+	{Name: "min", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "mean", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "max", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "count", Type: arrow.PrimitiveTypes.Uint64},
+}, nil)
+
+// resultColumns are the output rows in columnar layout,
+// sorted the same way as printOutput.
+type resultColumns struct {
+	station        []string
+	min, mean, max []float64
+	count          []uint64
+}
+
+func newResultColumns(sumStationData simpleMap) resultColumns {
+	var (
+		rows = outputRows(sumStationData, window{})
+		cols = resultColumns{
+			station: make([]string, 0, len(rows)),
+			min:     make([]float64, 0, len(rows)),
+			mean:    make([]float64, 0, len(rows)),
+			max:     make([]float64, 0, len(rows)),
+			count:   make([]uint64, 0, len(rows)),
+		}
+	)
+	for _, row := range rows {
+		cols.station = append(cols.station, string(row.name))
+		cols.min = append(cols.min, correctMagnitude(row.stats.min))
+		cols.mean = append(cols.mean, mean(row.stats.sum, row.stats.count))
+		cols.max = append(cols.max, correctMagnitude(row.stats.max))
+		cols.count = append(cols.count, uint64(row.stats.count))
+	}
+	return cols
+}
+
+// resultRecord is the output as single Arrow record batch.
+func resultRecord(sumStationData simpleMap) arrow.Record {
+	cols := newResultColumns(sumStationData)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, resultSchema)
+	defer b.Release()
+	b.Field(0).(*array.StringBuilder).AppendValues(cols.station, nil)
+	b.Field(1).(*array.Float64Builder).AppendValues(cols.min, nil)
+	b.Field(2).(*array.Float64Builder).AppendValues(cols.mean, nil)
+	b.Field(3).(*array.Float64Builder).AppendValues(cols.max, nil)
+	b.Field(4).(*array.Uint64Builder).AppendValues(cols.count, nil)
+	return b.NewRecord()
+}
+
+// writeArrow writes the Arrow IPC file with the output.
+func writeArrow(writer io.Writer, sumStationData simpleMap) error {
+	record := resultRecord(sumStationData)
+	defer record.Release()
+
+	w, err := ipc.NewFileWriter(writer, ipc.WithSchema(resultSchema))
+	if err != nil {
+		return err
+	}
+	err = w.Write(record)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertResultRecord checks the record read back by the Arrow
+// library matches the testData output.
+func assertResultRecord(t *testing.T, record arrow.Record) {
+	t.Helper()
+	want := newResultColumns(chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat))
+
+	require.Equal(t, int64(len(want.station)), record.NumRows())
+	require.Equal(t, int64(5), record.NumCols())
+	assert.Equal(t, []string{"station", "min", "mean", "max", "count"}, []string{
+		record.ColumnName(0), record.ColumnName(1), record.ColumnName(2), record.ColumnName(3), record.ColumnName(4),
+	})
+
+	stations := record.Column(0).(*array.String)
+	mins := record.Column(1).(*array.Float64)
+	means := record.Column(2).(*array.Float64)
+	maxs := record.Column(3).(*array.Float64)
+	counts := record.Column(4).(*array.Uint64)
+	for i := range want.station {
+		assert.Equal(t, want.station[i], stations.Value(i))
+		assert.Equal(t, want.min[i], mins.Value(i))
+		assert.Equal(t, want.mean[i], means.Value(i))
+		assert.Equal(t, want.max[i], maxs.Value(i))
+		assert.Equal(t, want.count[i], counts.Value(i))
+	}
+	assert.Equal(t, "Ljubljana", stations.Value(4))
+	assert.Equal(t, uint64(4), counts.Value(4))
+}
+
+func TestWriteArrow(t *testing.T) {
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, options{output: formatArrow}))
+
+	reader, err := ipc.NewFileReader(bytes.NewReader(buf.Bytes()), ipc.WithAllocator(memory.NewGoAllocator()))
+	require.NoError(t, err)
+	defer reader.Close()
+
+	require.Equal(t, 1, reader.NumRecords())
+	record, err := reader.Record(0)
+	require.NoError(t, err)
+	assertResultRecord(t, record)
+}
+
+func TestWriteArrowEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeArrow(&buf, newSimpleMap(10)))
+
+	reader, err := ipc.NewFileReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	defer reader.Close()
+	record, err := reader.Record(0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), record.NumRows())
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint stores how far the measurements file was processed together
+// with the aggregated state, so the next run reads only the appended
+// lines. The layout is (integers are varints):
+//
+//	magic "1BRCCKPT", version byte
+//	offset, dev, ino, crc32 of the file head
+//	config, length prefixed string
+//	state, length prefixed (see appendState)
+const (
+	checkpointMagic   = "1BRCCKPT"
+	checkpointVersion = 1
+)
+
+var (
+	// checkpointHeadSize bytes from the start of the file are hashed
+	// to detect the file was replaced (e.g. copytruncate rotation)
+	// and grew back past the offset before the next run.
+	checkpointHeadSize = 4 * kiB
+
+	errInvalidCheckpoint = errors.New("invalid checkpoint")
+)
+
+type checkpoint struct {
+	// offset is the end of the last complete line processed.
+	offset   int64
+	dev, ino uint64
+	head     uint32
+	// config must match, otherwise the saved state was aggregated
+	// with different line format or window.
+	config string
+
+	stationData simpleMap
+	window      window
+}
+
+func checkpointConfig(opts options) string {
+	return fmt.Sprintf("delimiter=%q decimal-sep=%q window=%q", opts.format.delimiter, opts.format.decimalSep, opts.window)
+}
+
+// aggregateIncremental aggregates only the data appended after the
+// checkpoint and merges it into the saved state. Truncated, rotated or
+// otherwise changed file is aggregated again from the start.
+func aggregateIncremental(f *os.File, opts options) (simpleMap, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return simpleMap{}, err
+	}
+	// The file can grow while we read it, we only read up to the size
+	// known now and the rest is processed on the next run.
+	size := fi.Size()
+	dev, ino := fileID(fi)
+
+	saved, err := readCheckpointFile(opts.checkpoint)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return simpleMap{}, err
+	}
+
+	var (
+		offset   int64
+		restored *simpleMap
+	)
+	if err == nil && saved.config == checkpointConfig(opts) && saved.dev == dev && saved.ino == ino && saved.offset <= size {
+		head, err := fileHead(f, saved.offset)
+		if err != nil {
+			return simpleMap{}, err
+		}
+		if head == saved.head {
+			offset = saved.offset
+			restored = &saved.stationData
+		}
+	}
+
+	end, err := lastLineEnd(f, offset, size)
+	if err != nil {
+		return simpleMap{}, err
+	}
+	stationData, err := aggregate(io.NewSectionReader(f, offset, end-offset), opts)
+	if err != nil {
+		return simpleMap{}, err
+	}
+	if restored != nil {
+		sumChunk(restored, stationData)
+		stationData = *restored
+	}
+
+	head, err := fileHead(f, end)
+	if err != nil {
+		return simpleMap{}, err
+	}
+	err = writeCheckpointFile(opts.checkpoint, checkpoint{
+		offset:      end,
+		dev:         dev,
+		ino:         ino,
+		head:        head,
+		config:      checkpointConfig(opts),
+		stationData: stationData,
+		window:      opts.window,
+	})
+	return stationData, err
+}
+
+// fileHead hashes first checkpointHeadSize bytes of the file, but
+// never more than the already processed part.
+func fileHead(f io.ReaderAt, offset int64) (uint32, error) {
+	data := make([]byte, min(offset, int64(checkpointHeadSize)))
+	_, err := f.ReadAt(data, 0)
+	if err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(data), nil
+}
+
+// lastLineEnd returns the offset right after the last `\n` in [start, end),
+// or start when there is no complete line. The incomplete last line is
+// still being written and will be read on the next run.
+func lastLineEnd(f io.ReaderAt, start, end int64) (int64, error) {
+	buf := make([]byte, 64*kiB)
+	for end > start {
+		blockStart := max(start, end-int64(len(buf)))
+		block := buf[:end-blockStart]
+		_, err := f.ReadAt(block, blockStart)
+		if err != nil {
+			return 0, err
+		}
+		idx := bytes.LastIndexByte(block, '\n')
+		if idx != -1 {
+			return blockStart + int64(idx) + 1, nil
+		}
+		end = blockStart
+	}
+	return start, nil
+}
+
+func appendCheckpoint(buf []byte, c checkpoint) []byte {
+	buf = append(buf, checkpointMagic...)
+	buf = append(buf, checkpointVersion)
+	buf = binary.AppendUvarint(buf, uint64(c.offset))
+	buf = binary.AppendUvarint(buf, c.dev)
+	buf = binary.AppendUvarint(buf, c.ino)
+	buf = binary.AppendUvarint(buf, uint64(c.head))
+	buf = appendStateString(buf, c.config)
+	state := appendState(nil, c.stationData, c.window)
+	buf = binary.AppendUvarint(buf, uint64(len(state)))
+	buf = append(buf, state...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+func readCheckpoint(data []byte) (checkpoint, error) {
+	header := len(checkpointMagic) + 1
+	if len(data) < header+4 || !bytes.Equal(data[:len(checkpointMagic)], []byte(checkpointMagic)) {
+		return checkpoint{}, fmt.Errorf("%w: not a checkpoint file", errInvalidCheckpoint)
+	}
+	if version := data[len(checkpointMagic)]; version != checkpointVersion {
+		return checkpoint{}, fmt.Errorf("%w: unsupported version: %d", errInvalidCheckpoint, version)
+	}
+	payload, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return checkpoint{}, fmt.Errorf("%w: checksum mismatch", errInvalidCheckpoint)
+	}
+
+	var (
+		c checkpoint
+		d = stateDecoder{data: payload[header:]}
+	)
+	c.offset = int64(d.uvarint("offset"))
+	c.dev = d.uvarint("dev")
+	c.ino = d.uvarint("ino")
+	c.head = uint32(d.uvarint("head"))
+	c.config = d.string("config")
+	state := d.string("state")
+	if d.err != nil {
+		return checkpoint{}, d.err
+	}
+
+	var err error
+	c.stationData, c.window, err = readState([]byte(state))
+	if err != nil {
+		return checkpoint{}, err
+	}
+	return c, nil
+}
+
+func readCheckpointFile(file string) (checkpoint, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	c, err := readCheckpoint(data)
+	if err != nil {
+		return checkpoint{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return c, nil
+}
+
+// writeCheckpointFile replaces the checkpoint atomically, so interrupted
+// run never leaves behind half written checkpoint.
+func writeCheckpointFile(file string, c checkpoint) error {
+	return writeFileAtomic(file, func(w io.Writer) error {
+		_, err := w.Write(appendCheckpoint(nil, c))
+		return err
+	})
+}
+
+// writeFileAtomic writes into temporary file next to the file
+// and renames it over the file once complete.
+func writeFileAtomic(file string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp makes the file readable only by the owner.
+	err = tmp.Chmod(0o644)
+	if err == nil {
+		err = write(tmp)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func incrementalOutput(t *testing.T, opts options) string {
+	t.Helper()
+	stationData, err := aggregateFile(opts)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, printOutput(&buf, stationData))
+	return buf.String()
+}
+
+func fullOutput(t *testing.T, data []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(data), 32), defaultLineFormat)
+	require.NoError(t, printOutput(&buf, stationData))
+	return buf.String()
+}
+
+func appendFile(t *testing.T, file string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestAggregateIncrementalAppend(t *testing.T) {
+	dir := t.TempDir()
+	opts := defaultOptions()
+	opts.file = filepath.Join(dir, "measurements.txt")
+	opts.checkpoint = filepath.Join(dir, "measurements.ckpt")
+
+	// Last line is still being written, it must not be counted yet.
+	require.NoError(t, os.WriteFile(opts.file, testData[:80], 0o644))
+	assert.Equal(t, fullOutput(t, testData[:74]), incrementalOutput(t, opts))
+
+	c, err := readCheckpointFile(opts.checkpoint)
+	require.NoError(t, err)
+	assert.Equal(t, int64(74), c.offset)
+
+	appendFile(t, opts.file, testData[80:])
+	assert.Equal(t, fullOutput(t, testData), incrementalOutput(t, opts))
+
+	// Nothing new was appended.
+	assert.Equal(t, fullOutput(t, testData), incrementalOutput(t, opts))
+
+	c, err = readCheckpointFile(opts.checkpoint)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(testData)), c.offset)
+}
+
+func TestAggregateIncrementalRescan(t *testing.T) {
+	dir := t.TempDir()
+	opts := defaultOptions()
+	opts.file = filepath.Join(dir, "measurements.txt")
+	opts.checkpoint = filepath.Join(dir, "measurements.ckpt")
+
+	require.NoError(t, os.WriteFile(opts.file, testData, 0o644))
+	assert.Equal(t, fullOutput(t, testData), incrementalOutput(t, opts))
+
+	// Truncated (size shrank).
+	require.NoError(t, os.WriteFile(opts.file, testData[:42], 0o644))
+	assert.Equal(t, fullOutput(t, testData[:42]), incrementalOutput(t, opts))
+
+	// Truncated and grew back past the offset with different data.
+	rewritten := append([]byte("Hamburg;12.0\n"), testData...)
+	require.NoError(t, os.WriteFile(opts.file, rewritten, 0o644))
+	assert.Equal(t, fullOutput(t, rewritten), incrementalOutput(t, opts))
+
+	// Rotated, new file (inode) with the same content.
+	rotated := filepath.Join(dir, "rotated.txt")
+	require.NoError(t, os.WriteFile(rotated, testData[:74], 0o644))
+	require.NoError(t, os.Rename(rotated, opts.file))
+	assert.Equal(t, fullOutput(t, testData[:74]), incrementalOutput(t, opts))
+
+	// Different line format can't reuse the saved state.
+	require.NoError(t, os.WriteFile(opts.file, bytes.ReplaceAll(testData[:74], []byte(";"), []byte("|")), 0o644))
+	opts.format, _ = newLineFormat("|", ".")
+	assert.Equal(t, fullOutput(t, testData[:74]), incrementalOutput(t, opts))
+}
+
+func TestCheckpointInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "measurements.ckpt")
+	require.NoError(t, os.WriteFile(file, []byte("garbage"), 0o644))
+
+	_, err := readCheckpointFile(file)
+	assert.ErrorIs(t, err, errInvalidCheckpoint)
+}
+
+func TestLastLineEnd(t *testing.T) {
+	r := bytes.NewReader(testData)
+	end, err := lastLineEnd(r, 0, int64(len(testData)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(testData)), end)
+
+	end, err = lastLineEnd(r, 0, 80)
+	require.NoError(t, err)
+	assert.Equal(t, int64(74), end)
+
+	end, err = lastLineEnd(r, 75, 80)
+	require.NoError(t, err)
+	assert.Equal(t, int64(75), end)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errInvalidMaxMemory = errors.New("invalid --max-memory")
+
+// chunkPool is a fixed set of reusable chunk buffers. The producer takes
+// a buffer for every chunk and the readers put it back once the chunk is
+// parsed, so the reading blocks while all of them are in use (the
+// back-pressure) and the chunks never take more than buffers*size.
+// nil pool allocates a new buffer for every chunk.
+type chunkPool struct {
+	free chan []byte
+	size int
+}
+
+// newChunkPool allocates the buffers on the first use,
+// small inputs don't need all of them.
+func newChunkPool(buffers, size int) *chunkPool {
+	p := &chunkPool{
+		free: make(chan []byte, buffers),
+		size: size,
+	}
+	for range buffers {
+		p.free <- nil
+	}
+	return p
+}
+
+// chunkBuffers is the number of buffers fitting into maxMemory. By default
+// the producer has one per reader and one more it reads the next chunk
+// into, with the claim scheduler each reader reads its next chunk.
+func chunkBuffers(maxMemory int, sch scheduler) (int, error) {
+	size := sch.bufferSize()
+	if maxMemory == 0 {
+		if sch == schedulerClaim {
+			return 2 * chunkReaders, nil
+		}
+		return chunkReaders + 1, nil
+	}
+	if maxMemory < size {
+		return 0, fmt.Errorf("%w: %d bytes is less than one chunk of %d bytes", errInvalidMaxMemory, maxMemory, size)
+	}
+	return maxMemory / size, nil
+}
+
+func (p *chunkPool) get(size int) []byte {
+	if p == nil {
+		return make([]byte, size)
+	}
+	buf := <-p.free
+	if buf == nil {
+		buf = make([]byte, p.size)
+	}
+	return buf
+}
+
+func (p *chunkPool) put(buf []byte) {
+	if p == nil {
+		return
+	}
+	p.free <- buf[:cap(buf)]
+}
+
+// parseByteSize parses sizes like 512MiB, 2GiB or plain bytes.
+func parseByteSize(s string) (int, error) {
+	units := []struct {
+		suffix string
+		size   int
+	}{
+		{"GiB", kiB * MiB},
+		{"MiB", MiB},
+		{"KiB", kiB},
+		{"kiB", kiB},
+		{"B", 1},
+	}
+	unit := 1
+	for _, u := range units {
+		if number, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, unit = number, u.size
+			break
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %q, expected bytes or size with KiB, MiB or GiB suffix", errInvalidMaxMemory, s)
+	}
+	return n * unit, nil
+}
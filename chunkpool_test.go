@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChunkPoolBackPressure holds the chunks without releasing them,
+// the producer must stop once all the buffers are taken.
+func TestChunkPoolBackPressure(t *testing.T) {
+	chunks := chunkByBytesPool(bytes.NewReader(testData), 32, newChunkPool(2, 32))
+	held := []chunk{<-chunks, <-chunks}
+
+	select {
+	case <-chunks:
+		t.Fatal("read 3rd chunk while all the buffers are in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	held[0].release()
+	c, ok := <-chunks
+	require.True(t, ok)
+	assert.Equal(t, &held[0].data[:1][0], &c.data[:1][0], "the released buffer is reused")
+	c.release()
+	held[1].release()
+
+	for c := range chunks {
+		c.release()
+	}
+}
+
+func TestAggregateMaxMemory(t *testing.T) {
+	var data bytes.Buffer
+	require.NoError(t, generate(&data, generateOptions{rows: 100_000, stations: 1000, seed: 6}))
+
+	defer func(size int) { chunkSize = size }(chunkSize)
+	chunkSize = 64 * kiB
+
+	var want bytes.Buffer
+	stationData, err := aggregate(bytes.NewReader(data.Bytes()), defaultOptions())
+	require.NoError(t, err)
+	require.NoError(t, writeOutput(&want, stationData, defaultOptions()))
+
+	for _, maxMemory := range []int{chunkSize, 3*chunkSize + 1} {
+		opts := defaultOptions()
+		opts.maxMemory = maxMemory
+		stationData, err := aggregate(bytes.NewReader(data.Bytes()), opts)
+		require.NoError(t, err)
+
+		var got bytes.Buffer
+		require.NoError(t, writeOutput(&got, stationData, opts))
+		assert.Equal(t, want.String(), got.String(), "max memory: %d", maxMemory)
+	}
+
+	opts := defaultOptions()
+	opts.maxMemory = chunkSize - 1
+	_, err = aggregate(bytes.NewReader(data.Bytes()), opts)
+	assert.ErrorIs(t, err, errInvalidMaxMemory)
+}
+
+func TestParseMaxMemory(t *testing.T) {
+	for s, want := range map[string]int{
+		"512MiB":   512 * MiB,
+		"2GiB":     2 * kiB * MiB,
+		"8192KiB":  8 * MiB,
+		"10485760": 10 * MiB,
+	} {
+		opts, err := parseOptions([]string{"--max-memory", s}, io.Discard)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, opts.maxMemory, s)
+	}
+
+	for _, s := range []string{"lots", "-1MiB", "1KiB"} {
+		_, err := parseOptions([]string{"--max-memory", s}, io.Discard)
+		assert.ErrorIs(t, err, errInvalidMaxMemory, s)
+	}
+}
+
+// BenchmarkChunkPool compares new buffer for every chunk with the pool,
+// the difference shows in B/op and peak RSS when run separately.
+func BenchmarkChunkPool(b *testing.B) {
+	var data bytes.Buffer
+	require.NoError(b, generate(&data, generateOptions{rows: 2_000_000, seed: 1}))
+	size := 1 * MiB
+
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled=%t", pooled), func(b *testing.B) {
+			b.SetBytes(int64(data.Len()))
+			b.ReportAllocs()
+			for range b.N {
+				var pool *chunkPool
+				if pooled {
+					pool = newChunkPool(chunkReaders+1, size)
+				}
+				chunkReader(chunkByBytesPool(bytes.NewReader(data.Bytes()), size, pool), defaultLineFormat)
+			}
+			reportPeakRSS(b)
+		})
+	}
+}
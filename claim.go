@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+type scheduler string
+
+const (
+	// schedulerProducer reads all the chunks in one goroutine
+	// and hands them to the workers over the channel.
+	schedulerProducer scheduler = "producer"
+	// schedulerClaim lets every worker claim the next range of the file
+	// and read it on its own, the reads are no longer serialized.
+	schedulerClaim scheduler = "claim"
+)
+
+var (
+	schedulers = []scheduler{schedulerProducer, schedulerClaim}
+
+	errInvalidScheduler = errors.New("invalid scheduler")
+)
+
+func parseScheduler(s string) (scheduler, error) {
+	for _, sch := range schedulers {
+		if string(sch) == s {
+			return sch, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q, expected one of: %v", errInvalidScheduler, s, schedulers)
+}
+
+// bufferSize is the size of the pooled chunk buffers.
+func (s scheduler) bufferSize() int {
+	if s == schedulerClaim {
+		return chunkSize + claimTail
+	}
+	return chunkSize
+}
+
+// claimTail is read after the claimed range, so the line crossing
+// its end doesn't need another read.
+var claimTail = 4 * kiB
+
+// chunkClaimer splits the file into ranges of size bytes, which the
+// workers claim with the atomic counter. A range's chunk are the lines
+// starting in it, so no line is read twice and the ranges don't have to
+// wait for each other to know where they start.
+type chunkClaimer struct {
+	f    io.ReaderAt
+	size int
+	pool *chunkPool
+	next atomic.Int64
+}
+
+// newChunkClaimer expects pool buffers of size+claimTail bytes.
+func newChunkClaimer(f io.ReaderAt, size int, pool *chunkPool) *chunkClaimer {
+	return &chunkClaimer{f: f, size: size, pool: pool}
+}
+
+// chunks reads the claimed chunks of one worker, the next one is read
+// while the worker parses the previous.
+func (c *chunkClaimer) chunks() chan chunk {
+	out := make(chan chunk)
+	go func() {
+		defer close(out)
+		for {
+			ch, ok, err := c.claim()
+			if err != nil {
+				panic(err)
+			}
+			if !ok {
+				return
+			}
+			if len(ch.data) == 0 {
+				ch.release()
+				continue
+			}
+			out <- ch
+		}
+	}()
+	return out
+}
+
+// claim reads the next range, ok is false past the end of the file.
+// The chunk is empty when no line starts in the range.
+func (c *chunkClaimer) claim() (chunk, bool, error) {
+	var (
+		start = (c.next.Add(1) - 1) * int64(c.size)
+		// The byte before the range tells if the first line starts in it.
+		off int
+	)
+	if start > 0 {
+		off = 1
+	}
+
+	buf := c.pool.get(c.size + claimTail)
+	n, err := c.f.ReadAt(buf, start-int64(off))
+	eof := err == io.EOF
+	if err != nil && !eof {
+		return chunk{}, false, err
+	}
+	ch := chunk{data: buf[:n], buf: buf, pool: c.pool}
+	if n <= off {
+		ch.release()
+		return chunk{}, false, nil
+	}
+
+	var begin int
+	if off == 1 {
+		idx := bytes.IndexByte(ch.data[:min(n, off+c.size)], '\n')
+		if idx == -1 || idx+1 >= off+c.size {
+			ch.data = ch.data[:0]
+			return ch, true, nil
+		}
+		begin = idx + 1
+	}
+
+	// The last line starting in the range ends at the first \n
+	// from the last byte of the range.
+	last := off + c.size - 1
+	if last >= n {
+		ch.data = ch.data[begin:]
+		return ch, true, nil
+	}
+	idx := bytes.IndexByte(ch.data[last:], '\n')
+	for idx == -1 && !eof {
+		// Line longer than claimTail, rare enough to read the
+		// rest into a new buffer.
+		more := make([]byte, claimTail)
+		m, err := c.f.ReadAt(more, start-int64(off)+int64(len(ch.data)))
+		eof = err == io.EOF
+		if err != nil && !eof {
+			ch.release()
+			return chunk{}, false, err
+		}
+		grown := chunk{data: append(ch.data[:len(ch.data):len(ch.data)], more[:m]...)}
+		ch.release()
+		ch = grown
+		idx = bytes.IndexByte(ch.data[last:], '\n')
+	}
+	end := len(ch.data)
+	if idx != -1 {
+		end = last + idx + 1
+	}
+	ch.data = ch.data[begin:end]
+	return ch, true, nil
+}
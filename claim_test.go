@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// claimAll reads all the chunks by a single worker, so they come in order.
+func claimAll(data []byte, size int, pool *chunkPool) []byte {
+	var out []byte
+	for c := range newChunkClaimer(bytes.NewReader(data), size, pool).chunks() {
+		out = append(out, c.data...)
+		c.release()
+	}
+	return out
+}
+
+// TestChunkClaimer expects every line in exactly one chunk for the ranges
+// shorter than the lines and the lines longer than claimTail too.
+func TestChunkClaimer(t *testing.T) {
+	defer func(tail int) { claimTail = tail }(claimTail)
+	for _, profile := range generateProfiles {
+		var data bytes.Buffer
+		require.NoError(t, generate(&data, generateOptions{profile: profile, rows: 1000, seed: 7, chunkSize: 4 * kiB}))
+
+		for _, tail := range []int{4 * kiB, 8} {
+			claimTail = tail
+			for _, size := range []int{1, 7, 127, 4 * kiB, 4*kiB + 1, 6 * MiB} {
+				assert.Equal(t, data.Bytes(), claimAll(data.Bytes(), size, nil), "profile: %s, size: %d, tail: %d", profile.name, size, tail)
+				pool := newChunkPool(2, size+claimTail)
+				assert.Equal(t, data.Bytes(), claimAll(data.Bytes(), size, pool), "profile: %s, size: %d, tail: %d", profile.name, size, tail)
+			}
+		}
+	}
+
+	// The last line without \n is kept as chunkByBytes does.
+	assert.Equal(t, []byte("Hamburg;1.0\nAbc;2.0"), claimAll([]byte("Hamburg;1.0\nAbc;2.0"), 5, nil))
+	assert.Empty(t, claimAll(nil, 5, nil))
+}
+
+func TestAggregateScheduler(t *testing.T) {
+	var data bytes.Buffer
+	require.NoError(t, generate(&data, generateOptions{rows: 100_000, stations: 1000, seed: 8}))
+
+	defer func(size, readers int) { chunkSize, chunkReaders = size, readers }(chunkSize, chunkReaders)
+	chunkSize, chunkReaders = 16*kiB, 4
+
+	outputs := map[scheduler]string{}
+	for _, sch := range schedulers {
+		for _, maxMemory := range []int{0, 3 * (chunkSize + claimTail)} {
+			opts := defaultOptions()
+			opts.scheduler = sch
+			opts.maxMemory = maxMemory
+			stationData, err := aggregate(bytes.NewReader(data.Bytes()), opts)
+			require.NoError(t, err)
+
+			var out bytes.Buffer
+			require.NoError(t, writeOutput(&out, stationData, opts))
+			if _, ok := outputs[sch]; !ok {
+				outputs[sch] = out.String()
+			}
+			assert.Equal(t, outputs[sch], out.String(), "scheduler: %s, max memory: %d", sch, maxMemory)
+		}
+	}
+	assert.Equal(t, outputs[schedulerProducer], outputs[schedulerClaim])
+}
+
+func TestParseScheduler(t *testing.T) {
+	opts, err := parseOptions(nil, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, schedulerProducer, opts.scheduler)
+
+	opts, err = parseOptions([]string{"--schedule", "claim"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, schedulerClaim, opts.scheduler)
+
+	_, err = parseOptions([]string{"--schedule", "round-robin"}, io.Discard)
+	assert.ErrorIs(t, err, errInvalidScheduler)
+}
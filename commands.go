@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+const rootUsage = `Usage: 1brc [flags] [measurements.txt]
+       1brc <command> [flags] [args]
+
+Commands:
+  aggregate  aggregate measurements into a state file (--state-out)
+  merge      merge state files and print the final output
+  serve      serve the aggregated files as JSON API over HTTP
+  diff       compare two outputs or state files
+  verify     check the output of measurements file against the expected output
+  generate   generate measurements file
+`
+
+// usageError is the error of parsing the flags, main exits with 2
+// for it like the flag package does.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// runCommand runs `1brc <command>` or the default 1BRC run when the
+// 1st argument is not a command.
+func runCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "aggregate":
+			return aggregateCommand(args[1:], os.Stderr)
+		case "merge":
+			return mergeCommand(args[1:], os.Stdout, os.Stderr)
+		case "serve":
+			return serveCommand(args[1:], os.Stderr)
+		case "diff":
+			return diffCommand(args[1:], os.Stdout, os.Stderr)
+		case "verify":
+			return verifyCommand(args[1:], os.Stdout, os.Stderr)
+		case "generate":
+			return generateCommand(args[1:], os.Stdout, os.Stderr)
+		}
+	}
+
+	opts, err := parseOptions(args, os.Stderr)
+	if err != nil {
+		return err
+	}
+	return run(opts)
+}
+
+// aggregateIgnoredFlags are the flags of the default run which don't
+// apply to the state file, aggregate rejects them.
+var aggregateIgnoredFlags = []string{
+	"format", "columns", "histogram", "follow", "snapshot-interval", "snapshot-out", "sqlite", "sqlite-chunk-stats",
+}
+
+// aggregateCommand is the map step of the map-reduce, it writes
+// the aggregated stats of one (part of) measurements file.
+func aggregateCommand(args []string, output io.Writer) error {
+	var (
+		stateOut string
+		flags    *flag.FlagSet
+	)
+	opts, err := parseCommandOptions(
+		"aggregate",
+		"Usage: 1brc aggregate --state-out part.state [flags] [measurements.txt]\n",
+		args,
+		output,
+		false,
+		func(fs *flag.FlagSet) {
+			fs.StringVar(&stateOut, "state-out", "", "write the aggregated state into this file (required)")
+			flags = fs
+		},
+	)
+	if err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if err == nil && slices.Contains(aggregateIgnoredFlags, f.Name) {
+			err = usageError{fmt.Errorf("aggregate: --%s does not apply to the state file", f.Name)}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if stateOut == "" {
+		return fmt.Errorf("aggregate: --state-out is required")
+	}
+
+	stationData, err := aggregateFile(opts)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(stateOut, stationData, opts.window)
+}
+
+// mergeCommand is the reduce step of the map-reduce, it merges the
+// state files and prints the output (or writes merged state).
+func mergeCommand(args []string, stdout, output io.Writer) error {
+	var (
+		formatName string
+		stateOut   string
+		fs         = flag.NewFlagSet("merge", flag.ContinueOnError)
+	)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: 1brc merge [flags] a.state b.state ...\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&formatName, "format", string(formatText), fmt.Sprintf("output format, one of: %v", outputFormats))
+	fs.StringVar(&stateOut, "state-out", "", "write the merged state into this file instead of printing the output")
+	err := fs.Parse(args)
+	if err != nil {
+		return usageError{err}
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("merge: expected at least 1 state file")
+	}
+
+	stationData, w, err := mergeStateFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	if stateOut != "" {
+		return writeStateFile(stateOut, stationData, w)
+	}
+
+	opts := defaultOptions()
+	opts.window = w
+	opts.output, err = parseOutputFormat(formatName)
+	if err != nil {
+		return err
+	}
+	return writeOutput(stdout, stationData, opts)
+}
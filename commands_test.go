@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateAndMergeCommands(t *testing.T) {
+	dir := t.TempDir()
+	parts := [][]byte{testData[:99], testData[99:]}
+	var states []string
+	for i, part := range parts {
+		input := filepath.Join(dir, "part"+string(rune('0'+i))+".txt")
+		require.NoError(t, os.WriteFile(input, part, 0o644))
+		state := input + ".state"
+		require.NoError(t, aggregateCommand([]string{"--state-out", state, input}, io.Discard))
+		states = append(states, state)
+	}
+
+	var got bytes.Buffer
+	require.NoError(t, mergeCommand(states, &got, io.Discard))
+
+	var want bytes.Buffer
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+	require.NoError(t, printOutput(&want, stationData))
+	assert.Equal(t, want.String(), got.String())
+
+	// Merging already merged state gives the same output.
+	merged := filepath.Join(dir, "merged.state")
+	require.NoError(t, mergeCommand(append([]string{"--state-out", merged}, states...), io.Discard, io.Discard))
+	got.Reset()
+	require.NoError(t, mergeCommand([]string{merged}, &got, io.Discard))
+	assert.Equal(t, want.String(), got.String())
+
+	assert.Error(t, aggregateCommand([]string{filepath.Join(dir, "part0.txt")}, io.Discard))
+	assert.Error(t, mergeCommand(nil, io.Discard, io.Discard))
+}
+
+func TestAggregateCommandIgnoredFlags(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "measurements.txt")
+	require.NoError(t, os.WriteFile(input, testData, 0o644))
+	state := filepath.Join(dir, "out.state")
+
+	for _, flags := range [][]string{
+		{"--histogram"},
+		{"--format", "json"},
+		{"--sqlite", filepath.Join(dir, "out.db")},
+		{"--follow"},
+	} {
+		args := append(append([]string{"--state-out", state}, flags...), input)
+		err := aggregateCommand(args, io.Discard)
+		assert.ErrorAs(t, err, new(usageError), flags[0])
+		assert.ErrorContains(t, err, flags[0], flags[0])
+	}
+	assert.NoFileExists(t, state)
+}
+
+// TestRunCommandUsageError expects the flag errors of every command
+// to be usageError, main exits with 2 for them.
+func TestRunCommandUsageError(t *testing.T) {
+	for _, command := range []string{"", "aggregate", "merge", "serve", "diff", "verify", "generate"} {
+		args := []string{"--bogus"}
+		if command != "" {
+			args = []string{command, "--bogus"}
+		}
+		assert.ErrorAs(t, runCommand(args), new(usageError), command)
+	}
+	assert.ErrorIs(t, runCommand([]string{"merge", "--help"}), flag.ErrHelp)
+
+	err := runCommand([]string{filepath.Join(t.TempDir(), "missing.txt")})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.False(t, errors.As(err, new(usageError)))
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	errDiffers          = errors.New("results differ")
+	errInvalidDiffInput = errors.New("invalid diff input")
+
+	// textOutputEntry matches one `name=min/mean/max` of the text output,
+	// the name is non-greedy so it can contain `=` or `, ` too.
+	textOutputEntry = regexp.MustCompile(`^(.+?)=(-?[0-9]+\.[0-9])/(-?[0-9]+\.[0-9])/(-?[0-9]+\.[0-9])(?:, |$)`)
+)
+
+// resultStats are the stats of a station read back from the output or
+// state file, the text output does not have the count.
+type resultStats struct {
+	min, mean, max float64
+	count          uint64
+	hasCount       bool
+}
+
+// readResultFile reads the state file, JSON or the text output.
+func readResultFile(file string) (map[string]resultStats, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var results map[string]resultStats
+	switch trimmed := bytes.TrimSpace(data); {
+	case bytes.HasPrefix(data, []byte(stateMagic)):
+		results, err = stateResults(data)
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		results, err = parseJSONOutput(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		results, err = parseTextOutput(trimmed)
+	default:
+		err = fmt.Errorf("%w: expected state file, JSON or text output", errInvalidDiffInput)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return results, nil
+}
+
+func stateResults(data []byte) (map[string]resultStats, error) {
+	stationData, w, err := readState(data)
+	if err != nil {
+		return nil, err
+	}
+	if w.enabled() {
+		return nil, fmt.Errorf("%w: windowed state", errInvalidDiffInput)
+	}
+	results := make(map[string]resultStats, stationData.len())
+	for _, item := range stationData.Iter() {
+		results[string(item.name)] = resultStats{
+			min:      correctMagnitude(item.stats.min),
+			mean:     mean(item.stats.sum, item.stats.count),
+			max:      correctMagnitude(item.stats.max),
+			count:    uint64(item.stats.count),
+			hasCount: true,
+		}
+	}
+	return results, nil
+}
+
+func parseJSONOutput(data []byte) (map[string]resultStats, error) {
+	// jsonStation embeds the stats as pointer to unexported type,
+	// which json can't allocate when decoding.
+	var stations []struct {
+		Station string `json:"station"`
+		jsonStats
+		Series []jsonStats `json:"series"`
+	}
+	err := json.Unmarshal(data, &stations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidDiffInput, err)
+	}
+	results := make(map[string]resultStats, len(stations))
+	for _, station := range stations {
+		if len(station.Series) > 0 {
+			return nil, fmt.Errorf("%w: station %q has time series, windowed output is not supported", errInvalidDiffInput, station.Station)
+		}
+		results[station.Station] = resultStats{
+			min:      float64(station.Min),
+			mean:     float64(station.Mean),
+			max:      float64(station.Max),
+			count:    uint64(station.Count),
+			hasCount: true,
+		}
+	}
+	return results, nil
+}
+
+// parseTextOutput parses the original `{name=min/mean/max, ...}` output.
+func parseTextOutput(data []byte) (map[string]resultStats, error) {
+	if !bytes.HasPrefix(data, []byte("{")) || !bytes.HasSuffix(data, []byte("}")) {
+		return nil, fmt.Errorf("%w: text output must be enclosed in {}", errInvalidDiffInput)
+	}
+	var (
+		rest    = string(data[1 : len(data)-1])
+		results = make(map[string]resultStats)
+	)
+	for rest != "" {
+		match := textOutputEntry.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("%w: can't parse station at: %.40q", errInvalidDiffInput, rest)
+		}
+		var values [3]float64
+		for i := range values {
+			// The regexp guarantees valid numbers.
+			values[i], _ = strconv.ParseFloat(match[2+i], 64)
+		}
+		results[match[1]] = resultStats{min: values[0], mean: values[1], max: values[2]}
+		rest = rest[len(match[0]):]
+	}
+	return results, nil
+}
+
+// diffTolerance are the largest differences which are not reported.
+type diffTolerance struct {
+	temperature float64
+	count       uint64
+}
+
+// fieldDelta formats the change of the field if it exceeds the tolerance.
+func fieldDelta(name string, a, b, tolerance float64) (string, bool) {
+	delta := b - a
+	// The values have 1 decimal digit, the epsilon hides float errors
+	// of the subtraction, e.g. 0.3-0.2 > 0.1.
+	if math.Abs(delta) <= tolerance+1e-9 {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s -> %s (%+.1f)", name, formatFloat(a), formatFloat(b), delta), true
+}
+
+func formatResult(st resultStats) string {
+	s := formatFloat(st.min) + "/" + formatFloat(st.mean) + "/" + formatFloat(st.max)
+	if st.hasCount {
+		s += " count " + strconv.FormatUint(st.count, 10)
+	}
+	return s
+}
+
+// diffResults writes the added, removed and changed stations sorted
+// by name and returns the number of the differences.
+func diffResults(writer io.Writer, a, b map[string]resultStats, tolerance diffTolerance) (int, error) {
+	names := make([]string, 0, max(len(a), len(b)))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var (
+		buf                     strings.Builder
+		added, removed, changed int
+	)
+	for _, name := range names {
+		before, inA := a[name]
+		after, inB := b[name]
+		switch {
+		case !inA:
+			added++
+			fmt.Fprintf(&buf, "+ %s: %s\n", name, formatResult(after))
+			continue
+		case !inB:
+			removed++
+			fmt.Fprintf(&buf, "- %s: %s\n", name, formatResult(before))
+			continue
+		}
+
+		var deltas []string
+		for _, field := range []struct {
+			name string
+			a, b float64
+		}{
+			{"min", before.min, after.min},
+			{"mean", before.mean, after.mean},
+			{"max", before.max, after.max},
+		} {
+			if delta, ok := fieldDelta(field.name, field.a, field.b, tolerance.temperature); ok {
+				deltas = append(deltas, delta)
+			}
+		}
+		if before.hasCount && after.hasCount {
+			countDelta := int64(after.count) - int64(before.count)
+			if uint64(max(countDelta, -countDelta)) > tolerance.count {
+				deltas = append(deltas, fmt.Sprintf("count %d -> %d (%+d)", before.count, after.count, countDelta))
+			}
+		}
+		if len(deltas) > 0 {
+			changed++
+			fmt.Fprintf(&buf, "~ %s: %s\n", name, strings.Join(deltas, ", "))
+		}
+	}
+	fmt.Fprintf(&buf, "%d stations: %d added, %d removed, %d changed\n", len(names), added, removed, changed)
+
+	_, err := io.WriteString(writer, buf.String())
+	return added + removed + changed, err
+}
+
+// diffCommand: 1brc diff [--tolerance 0.1] a.out b.out
+func diffCommand(args []string, stdout, output io.Writer) error {
+	var (
+		tolerance diffTolerance
+		fs        = flag.NewFlagSet("diff", flag.ContinueOnError)
+	)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: 1brc diff [flags] a.out b.out\n\n"+
+			"Inputs are the text or JSON outputs or state files. Exits with error when they differ.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Float64Var(&tolerance.temperature, "tolerance", 0, "largest min/mean/max difference in °C which is not reported")
+	fs.Uint64Var(&tolerance.count, "count-tolerance", 0, "largest count difference which is not reported")
+	err := fs.Parse(args)
+	if err != nil {
+		return usageError{err}
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("diff: expected 2 files, got: %d", fs.NArg())
+	}
+	if tolerance.temperature < 0 {
+		return fmt.Errorf("diff: --tolerance must not be negative, got: %v", tolerance.temperature)
+	}
+
+	a, err := readResultFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := readResultFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	differences, err := diffResults(stdout, a, b, tolerance)
+	if err != nil {
+		return err
+	}
+	if differences > 0 {
+		return fmt.Errorf("%w: %d differences beyond the tolerance", errDiffers, differences)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeResultFile(t *testing.T, dir, name string, data []byte, output outputFormat) string {
+	t.Helper()
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(data), 32), defaultLineFormat)
+	file := filepath.Join(dir, name)
+	if output == "" {
+		require.NoError(t, writeStateFile(file, stationData, window{}))
+		return file
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, options{output: output}))
+	require.NoError(t, os.WriteFile(file, buf.Bytes(), 0o644))
+	return file
+}
+
+func TestReadResultFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, output := range []outputFormat{formatText, formatJSON, ""} {
+		results, err := readResultFile(writeResultFile(t, dir, "out."+string(output), testData, output))
+		require.NoError(t, err, output)
+		require.Len(t, results, 10, output)
+		ljubljana := results["Ljubljana"]
+		assert.Equal(t, -24.3, ljubljana.min, output)
+		assert.Equal(t, 0.0, ljubljana.mean, output)
+		assert.Equal(t, 24.3, ljubljana.max, output)
+		assert.Equal(t, output != formatText, ljubljana.hasCount, output)
+	}
+
+	// Names with the separators of the text output.
+	results, err := parseTextOutput([]byte("{a=b, c=1.0/2.0/3.0, Ürümqi=-0.3/-0.3/-0.3}"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]resultStats{
+		"a=b, c": {min: 1, mean: 2, max: 3},
+		"Ürümqi": {min: -0.3, mean: -0.3, max: -0.3},
+	}, results)
+	results, err = parseTextOutput([]byte("{}"))
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	for _, invalid := range []string{"{a=1.0/2.0}", "{a=1.0/2.0/x}", "a=1.0/2.0/3.0"} {
+		_, err = parseTextOutput([]byte(invalid))
+		assert.ErrorIs(t, err, errInvalidDiffInput, invalid)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	a := writeResultFile(t, dir, "a.json", testData, formatJSON)
+	b := writeResultFile(t, dir, "b.out", append(testData, "Ljubljana;24.6\nOslo;-3.0\n"...), formatText)
+	c := writeResultFile(t, dir, "c.state", bytes.Replace(testData, []byte("Nassau;22.7\n"), nil, 1), "")
+
+	var out bytes.Buffer
+	require.NoError(t, diffCommand([]string{a, a}, &out, io.Discard))
+	assert.Equal(t, "10 stations: 0 added, 0 removed, 0 changed\n", out.String())
+
+	out.Reset()
+	err := diffCommand([]string{a, b}, &out, io.Discard)
+	assert.ErrorIs(t, err, errDiffers)
+	assert.Equal(t, `~ Ljubljana: mean 0.0 -> 4.9 (+4.9), max 24.3 -> 24.6 (+0.3)
++ Oslo: -3.0/-3.0/-3.0
+11 stations: 1 added, 0 removed, 1 changed
+`, out.String())
+
+	// Within the tolerance only the added station is reported.
+	out.Reset()
+	err = diffCommand([]string{"--tolerance", "5", a, b}, &out, io.Discard)
+	assert.ErrorIs(t, err, errDiffers)
+	assert.Equal(t, "+ Oslo: -3.0/-3.0/-3.0\n11 stations: 1 added, 0 removed, 0 changed\n", out.String())
+
+	out.Reset()
+	err = diffCommand([]string{c, a}, &out, io.Discard)
+	assert.ErrorIs(t, err, errDiffers)
+	assert.Equal(t, "+ Nassau: 22.7/22.7/22.7 count 1\n10 stations: 1 added, 0 removed, 0 changed\n", out.String())
+
+	assert.Error(t, diffCommand([]string{a}, io.Discard, io.Discard))
+	assert.Error(t, diffCommand([]string{"--tolerance", "-1", a, a}, io.Discard, io.Discard))
+	assert.Error(t, diffCommand([]string{a, filepath.Join(dir, "missing")}, io.Discard, io.Discard))
+}
+
+func TestDiffResultsCount(t *testing.T) {
+	a := map[string]resultStats{"A": {min: 1, mean: 2, max: 3, count: 10, hasCount: true}}
+	b := map[string]resultStats{"A": {min: 1, mean: 2, max: 3, count: 7, hasCount: true}}
+
+	var out bytes.Buffer
+	differences, err := diffResults(&out, a, b, diffTolerance{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, differences)
+	assert.Equal(t, "~ A: count 10 -> 7 (-3)\n1 stations: 0 added, 0 removed, 1 changed\n", out.String())
+
+	differences, err = diffResults(io.Discard, a, b, diffTolerance{count: 3})
+	require.NoError(t, err)
+	assert.Zero(t, differences)
+}
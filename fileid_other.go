@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileID is not supported outside of unix, rotation is then
+// detected only by the file size and content of its head.
+func fileID(fi os.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// followPollInterval is how often the file is checked for new lines
+	// in --follow mode. Polling works everywhere (including network
+	// filesystems where inotify does not) and is cheap compared to the
+	// aggregation itself.
+	followPollInterval = 250 * time.Millisecond
+
+	errFollowCheckpoint = errors.New("--follow can't be used with --checkpoint")
+)
+
+// followState is the aggregated state of the followed file.
+type followState struct {
+	f        *os.File
+	dev, ino uint64
+	// offset is the end of the last complete line processed.
+	offset int64
+	// head is the fileHead of the processed part, truncated file
+	// which grew back past the offset between the polls changes it.
+	head        uint32
+	stationData simpleMap
+}
+
+// follow is like `tail -F`, it keeps reading new complete lines appended to
+// the file and writes snapshot of the aggregated output every
+// opts.snapshotInterval. A rotated or truncated file is read from the start.
+// The final snapshot is written when ctx is done.
+func follow(ctx context.Context, opts options, stdout io.Writer) error {
+	var st followState
+	defer func() {
+		if st.f != nil {
+			st.f.Close()
+		}
+	}()
+
+	err := st.poll(opts)
+	if err != nil {
+		return err
+	}
+	err = writeSnapshot(stdout, st.stationData, opts)
+	if err != nil {
+		return err
+	}
+
+	var (
+		poll     = time.NewTicker(followPollInterval)
+		snapshot = time.NewTicker(opts.snapshotInterval)
+	)
+	defer poll.Stop()
+	defer snapshot.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return writeSnapshot(stdout, st.stationData, opts)
+		case <-poll.C:
+			err = st.poll(opts)
+			if err != nil {
+				return err
+			}
+		case <-snapshot.C:
+			err = writeSnapshot(stdout, st.stationData, opts)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// poll reads the lines appended since the last poll and merges them in.
+func (st *followState) poll(opts options) error {
+	fi, err := os.Stat(opts.file)
+	if errors.Is(err, os.ErrNotExist) && st.f != nil {
+		// Rotation renamed the file and did not create the new one
+		// yet, like `tail -F` we keep the state and try again.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dev, ino := fileID(fi)
+	rotated := st.f == nil || dev != st.dev || ino != st.ino || fi.Size() < st.offset
+	if !rotated && st.offset > 0 {
+		// copytruncate keeps the inode, the file only has to grow
+		// past the offset before the next poll to look appended.
+		head, err := fileHead(st.f, st.offset)
+		if err != nil {
+			return err
+		}
+		rotated = head != st.head
+	}
+	if rotated {
+		err = st.reset(opts.file)
+		if errors.Is(err, os.ErrNotExist) && st.f != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// The file could be replaced again between Stat and Open.
+		fi, err = st.f.Stat()
+		if err != nil {
+			return err
+		}
+	}
+
+	size := fi.Size()
+	if size == st.offset {
+		return nil
+	}
+	end, err := lastLineEnd(st.f, st.offset, size)
+	if err != nil {
+		return err
+	}
+	if end == st.offset {
+		return nil
+	}
+
+	stationData, err := aggregate(io.NewSectionReader(st.f, st.offset, end-st.offset), opts)
+	if err != nil {
+		return err
+	}
+	sumChunk(&st.stationData, stationData)
+	st.offset = end
+	st.head, err = fileHead(st.f, st.offset)
+	return err
+}
+
+// reset (re)opens the file and drops everything aggregated so far.
+// When the file can't be opened the previous state is kept.
+func (st *followState) reset(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if st.f != nil {
+		st.f.Close()
+	}
+	st.f = f
+	st.dev, st.ino = fileID(fi)
+	st.offset, st.head = 0, 0
+	st.stationData = newSimpleMap(maxStations)
+	return nil
+}
+
+// writeSnapshot writes the output to stdout or atomically replaces
+// the opts.snapshotOut file, so the readers never see partial output.
+func writeSnapshot(stdout io.Writer, stationData simpleMap, opts options) error {
+	if opts.snapshotOut == "" {
+		return writeOutput(stdout, stationData, opts)
+	}
+	return writeFileAtomic(opts.snapshotOut, func(w io.Writer) error {
+		return writeOutput(w, stationData, opts)
+	})
+}
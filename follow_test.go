@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollow(t *testing.T) {
+	defer func(interval time.Duration) { followPollInterval = interval }(followPollInterval)
+	followPollInterval = 5 * time.Millisecond
+
+	dir := t.TempDir()
+	opts := defaultOptions()
+	opts.file = filepath.Join(dir, "measurements.txt")
+	opts.snapshotOut = filepath.Join(dir, "snapshot.out")
+	opts.snapshotInterval = 10 * time.Millisecond
+	require.NoError(t, os.WriteFile(opts.file, testData[:80], 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- follow(ctx, opts, io.Discard)
+	}()
+
+	snapshotEquals := func(want string) func() bool {
+		return func() bool {
+			got, err := os.ReadFile(opts.snapshotOut)
+			return err == nil && string(got) == want
+		}
+	}
+	// Incomplete last line is not included until it is finished.
+	require.Eventually(t, snapshotEquals(fullOutput(t, testData[:74])), time.Second, time.Millisecond)
+
+	appendFile(t, opts.file, testData[80:])
+	require.Eventually(t, snapshotEquals(fullOutput(t, testData)), time.Second, time.Millisecond)
+
+	// Rotation starts again from the new file.
+	rotated := filepath.Join(dir, "rotated.txt")
+	require.NoError(t, os.WriteFile(rotated, testData[:42], 0o644))
+	require.NoError(t, os.Rename(rotated, opts.file))
+	require.Eventually(t, snapshotEquals(fullOutput(t, testData[:42])), time.Second, time.Millisecond)
+
+	// Truncation as well.
+	require.NoError(t, os.WriteFile(opts.file, testData[:27], 0o644))
+	require.Eventually(t, snapshotEquals(fullOutput(t, testData[:27])), time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+// TestFollowCopyTruncate truncates the file in place and writes more
+// than before, so neither the size nor the inode tell it between the polls.
+func TestFollowCopyTruncate(t *testing.T) {
+	opts := defaultOptions()
+	opts.file = filepath.Join(t.TempDir(), "measurements.txt")
+	require.NoError(t, os.WriteFile(opts.file, testData[:74], 0o644))
+
+	var st followState
+	defer func() { st.f.Close() }()
+	require.NoError(t, st.poll(opts))
+	require.Equal(t, int64(74), st.offset)
+
+	require.NoError(t, os.WriteFile(opts.file, testData[74:], 0o644))
+	require.NoError(t, st.poll(opts))
+
+	var got bytes.Buffer
+	require.NoError(t, printOutput(&got, st.stationData))
+	assert.Equal(t, fullOutput(t, testData[74:]), got.String())
+}
+
+// TestFollowRotationGap polls between the rename of the rotation and
+// the creation of the new file, the state is kept until it appears.
+func TestFollowRotationGap(t *testing.T) {
+	opts := defaultOptions()
+	opts.file = filepath.Join(t.TempDir(), "measurements.txt")
+	require.NoError(t, os.WriteFile(opts.file, testData[:74], 0o644))
+
+	var st followState
+	defer func() { st.f.Close() }()
+	require.NoError(t, st.poll(opts))
+
+	require.NoError(t, os.Rename(opts.file, opts.file+".1"))
+	require.NoError(t, st.poll(opts))
+	var got bytes.Buffer
+	require.NoError(t, printOutput(&got, st.stationData))
+	assert.Equal(t, fullOutput(t, testData[:74]), got.String())
+
+	require.NoError(t, os.WriteFile(opts.file, testData[74:], 0o644))
+	require.NoError(t, st.poll(opts))
+	got.Reset()
+	require.NoError(t, printOutput(&got, st.stationData))
+	assert.Equal(t, fullOutput(t, testData[74:]), got.String())
+}
+
+func TestFollowMissingFile(t *testing.T) {
+	opts := defaultOptions()
+	opts.file = filepath.Join(t.TempDir(), "missing.txt")
+	err := follow(context.Background(), opts, io.Discard)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
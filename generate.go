@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// generateBlockRows is the number of rows each generate worker writes at once,
+// every block has its own random source so the file is the same no matter
+// how many workers generated it.
+const generateBlockRows = 64 * 1024
+
+var errInvalidGenerateOptions = errors.New("invalid generate options")
+
+type weatherStation struct {
+	name            string
+	meanTemperature float64
+}
+
+type generateOptions struct {
+	profile generateProfile
+	rows    int64
+	// stations is the number of unique stations, 0 is the profile's default.
+	stations int
+	seed     uint64
+	workers  int
+	// chunkSize is the size the file of fixed line length profile is aligned to.
+	chunkSize int
+	// reference receives the expected text output of the generated file.
+	reference io.Writer
+}
+
+// generateStations returns n stations, a random subset of the reference
+// stations when there are enough of them, otherwise all of them plus
+// unique names made of 2 reference stations (like `Abha-Zürich`) with
+// the temperature in between. 10k stations is the 10k unique keys variant.
+func generateStations(n int, seed uint64) ([]weatherStation, error) {
+	if n < 1 || n > len(referenceStations)*len(referenceStations) {
+		return nil, fmt.Errorf("%w: stations must be between 1 and %d, got: %d",
+			errInvalidGenerateOptions, len(referenceStations)*len(referenceStations), n)
+	}
+	rng := rand.New(rand.NewPCG(seed, 0))
+	if n <= len(referenceStations) {
+		stations := make([]weatherStation, n)
+		for i, idx := range rng.Perm(len(referenceStations))[:n] {
+			stations[i] = referenceStations[idx]
+		}
+		return stations, nil
+	}
+
+	stations := slices.Clone(referenceStations)
+	seen := make(map[string]bool, n)
+	for _, station := range stations {
+		seen[station.name] = true
+	}
+	for len(stations) < n {
+		a := referenceStations[rng.IntN(len(referenceStations))]
+		b := referenceStations[rng.IntN(len(referenceStations))]
+		name := truncateName(a.name+"-"+b.name, maxStationNameLen)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		stations = append(stations, weatherStation{name: name, meanTemperature: (a.meanTemperature + b.meanTemperature) / 2})
+	}
+	return stations, nil
+}
+
+// truncateName cuts the name to at most n bytes without splitting a rune.
+func truncateName(name string, n int) string {
+	if len(name) <= n {
+		return name
+	}
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return name[:n]
+}
+
+// appendMeasurement appends the measurement *10 with one fractional digit.
+func appendMeasurement(buf []byte, m measurement) []byte {
+	if m < 0 {
+		buf = append(buf, '-')
+		m = -m
+	}
+	buf = strconv.AppendInt(buf, int64(m/10), 10)
+	return append(buf, '.', byte('0'+m%10))
+}
+
+// gaussianMeasurement is the temperature around the mean with standard
+// deviation of 10 like the reference, clamped to the valid range.
+func gaussianMeasurement(rng *rand.Rand, mean float64) measurement {
+	m := math.Round((rng.NormFloat64()*10 + mean) * 10)
+	return measurement(min(max(m, -999), 999))
+}
+
+// generatedBlock are the rows of the block and, when the reference output
+// is requested, stats of each station indexed the same as the stations.
+type generatedBlock struct {
+	data  []byte
+	stats []stats
+}
+
+// generateBlock generates the rows of the block.
+func generateBlock(profile generateProfile, stations []weatherStation, seed uint64, block, rows int64, collectStats bool) generatedBlock {
+	var (
+		rng = rand.New(rand.NewPCG(seed, uint64(block)+1))
+		out = generatedBlock{data: make([]byte, 0, rows*16)}
+	)
+	if collectStats {
+		out.stats = make([]stats, len(stations))
+	}
+	for range rows {
+		idx := rng.IntN(len(stations))
+		m := profile.measurement(rng, stations[idx])
+		out.data = append(out.data, stations[idx].name...)
+		out.data = append(out.data, ';')
+		out.data = appendMeasurement(out.data, m)
+		out.data = append(out.data, '\n')
+		if collectStats {
+			updateStats(&out.stats[idx], m)
+		}
+	}
+	return out
+}
+
+// mergeStats adds the src stats into dst, both can be empty.
+func mergeStats(dst *stats, src stats) {
+	switch {
+	case src.count == 0:
+		return
+	case dst.count == 0:
+		*dst = src
+		return
+	}
+	dst.count += src.count
+	dst.sum += src.sum
+	dst.min = min(dst.min, src.min)
+	dst.max = max(dst.max, src.max)
+}
+
+// writeReference writes the text output of the generated file. It is
+// computed from the generated values, independently of the parsing
+// and the map used by the aggregation, so it can verify them.
+func writeReference(writer io.Writer, stations []weatherStation, sums []stats) error {
+	idxs := make([]int, 0, len(stations))
+	for i := range stations {
+		if sums[i].count > 0 {
+			idxs = append(idxs, i)
+		}
+	}
+	sort.Slice(idxs, func(i, j int) bool { return stations[idxs[i]].name < stations[idxs[j]].name })
+
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, idx := range idxs {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		st := sums[idx]
+		fmt.Fprintf(&builder, "%s=%.1f/%.1f/%.1f", stations[idx].name, correctMagnitude(st.min), mean(st.sum, st.count), correctMagnitude(st.max))
+	}
+	builder.WriteString("}\n")
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
+
+type generateJob struct {
+	block  int64
+	rows   int64
+	result chan generatedBlock
+}
+
+// generate writes the measurements, the blocks are generated in parallel
+// and written in order, at most 2 blocks per worker are in flight.
+func generate(writer io.Writer, opts generateOptions) error {
+	profile := opts.profile
+	if profile.name == "" {
+		profile = generateProfiles[0]
+	}
+	if opts.stations == 0 {
+		opts.stations = profile.defaultStations
+	}
+	stations, err := profile.stations(opts.stations, opts.seed)
+	if err != nil {
+		return err
+	}
+	if profile.lineLen > 0 {
+		if opts.chunkSize <= 0 || opts.chunkSize%profile.lineLen != 0 {
+			return fmt.Errorf("%w: %s profile needs chunk size divisible by %d, got: %d",
+				errInvalidGenerateOptions, profile.name, profile.lineLen, opts.chunkSize)
+		}
+		// Rounds up to whole chunks, so the file ends exactly at the chunk end.
+		rowsPerChunk := int64(opts.chunkSize / profile.lineLen)
+		opts.rows = (opts.rows + rowsPerChunk - 1) / rowsPerChunk * rowsPerChunk
+	}
+
+	var (
+		workers = max(opts.workers, 1)
+		blocks  = (opts.rows + generateBlockRows - 1) / generateBlockRows
+		sums    []stats
+
+		queue = make(chan chan generatedBlock, 2*workers)
+		jobs  = make(chan generateJob)
+		done  = make(chan struct{})
+	)
+	defer close(done)
+
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+		for block := range blocks {
+			job := generateJob{
+				block:  block,
+				rows:   min(generateBlockRows, opts.rows-block*generateBlockRows),
+				result: make(chan generatedBlock, 1),
+			}
+			select {
+			case queue <- job.result:
+			case <-done:
+				return
+			}
+			jobs <- job
+		}
+	}()
+	for range workers {
+		go func() {
+			for job := range jobs {
+				job.result <- generateBlock(profile, stations, opts.seed, job.block, job.rows, opts.reference != nil)
+			}
+		}()
+	}
+
+	if opts.reference != nil {
+		sums = make([]stats, len(stations))
+	}
+	for result := range queue {
+		block := <-result
+		_, err := writer.Write(block.data)
+		if err != nil {
+			return err
+		}
+		for i, st := range block.stats {
+			mergeStats(&sums[i], st)
+		}
+	}
+	if opts.reference != nil {
+		return writeReference(opts.reference, stations, sums)
+	}
+	return nil
+}
+
+// parseRows parses the number of rows, which can be written
+// also as 1e9 or 1_000_000_000.
+func parseRows(s string) (int64, error) {
+	s = strings.ReplaceAll(s, "_", "")
+	rows, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		f, floatErr := strconv.ParseFloat(s, 64)
+		if floatErr != nil || f != math.Trunc(f) || f > 1<<53 {
+			return 0, fmt.Errorf("%w: invalid rows: %q", errInvalidGenerateOptions, s)
+		}
+		rows = int64(f)
+	}
+	if rows < 0 {
+		return 0, fmt.Errorf("%w: rows must not be negative, got: %d", errInvalidGenerateOptions, rows)
+	}
+	return rows, nil
+}
+
+// generateCommand: 1brc generate --rows 1e9 --stations 10000 --seed 42 -o measurements.txt
+func generateCommand(args []string, stdout, output io.Writer) error {
+	var (
+		opts        = generateOptions{workers: runtime.NumCPU()}
+		rows        string
+		out         string
+		profileName string
+		reference   string
+		fs          = flag.NewFlagSet("generate", flag.ContinueOnError)
+	)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: 1brc generate [flags]\n\nProfiles:\n")
+		for _, profile := range generateProfiles {
+			fmt.Fprintf(fs.Output(), "  %-14s %s\n", profile.name, profile.description)
+		}
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&rows, "rows", "1e9", "number of rows, e.g. 1e9 or 1_000_000")
+	fs.IntVar(&opts.stations, "stations", 0, "number of unique stations, 10000 for the 10k unique keys variant (default depends on the profile)")
+	fs.Uint64Var(&opts.seed, "seed", 42, "seed of the random generator, the same seed generates the same file")
+	fs.StringVar(&out, "o", "", "output file (default stdout)")
+	fs.StringVar(&profileName, "profile", generateProfiles[0].name, "profile of the generated data, see above")
+	fs.StringVar(&reference, "reference", "", "write the expected text output into the file, for 1brc verify")
+	hashSeedFlag(fs)
+	fs.IntVar(&opts.chunkSize, "chunk-size", chunkSize, "chunk size the chunk-multiple profile aligns the file size to")
+	err := fs.Parse(args)
+	if err != nil {
+		return usageError{err}
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("generate: unexpected arguments: %v", fs.Args())
+	}
+	opts.rows, err = parseRows(rows)
+	if err != nil {
+		return err
+	}
+	opts.profile, err = lookupProfile(profileName)
+	if err != nil {
+		return err
+	}
+	if opts.profile.hashSeeded {
+		seeded := false
+		fs.Visit(func(f *flag.Flag) {
+			seeded = seeded || f.Name == "hash-seed"
+		})
+		if !seeded {
+			hashSeed = profileHashSeed
+		}
+	}
+
+	var buf bytes.Buffer
+	if reference != "" {
+		opts.reference = &buf
+	}
+	err = generateFile(out, stdout, opts)
+	if err != nil || reference == "" {
+		return err
+	}
+	return writeFileAtomic(reference, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// generateFile generates into the file or stdout when file is empty.
+func generateFile(file string, stdout io.Writer, opts generateOptions) error {
+	if file == "" {
+		return generate(stdout, opts)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = generate(f, opts)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferenceStations(t *testing.T) {
+	assert.Len(t, referenceStations, 413)
+	seen := map[string]bool{}
+	for _, station := range referenceStations {
+		assert.False(t, seen[station.name], station.name)
+		seen[station.name] = true
+	}
+}
+
+func TestGenerateStations(t *testing.T) {
+	for _, n := range []int{1, 100, len(referenceStations), 10_000} {
+		stations, err := generateStations(n, 42)
+		require.NoError(t, err)
+		require.Len(t, stations, n)
+		seen := map[string]bool{}
+		for _, station := range stations {
+			assert.False(t, seen[station.name], station.name)
+			seen[station.name] = true
+			assert.LessOrEqual(t, len(station.name), maxStationNameLen)
+			assert.True(t, utf8.ValidString(station.name), station.name)
+		}
+	}
+
+	_, err := generateStations(0, 42)
+	assert.ErrorIs(t, err, errInvalidGenerateOptions)
+}
+
+func TestTruncateName(t *testing.T) {
+	assert.Equal(t, "abc", truncateName("abc", 3))
+	assert.Equal(t, "ab", truncateName("abc", 2))
+	// ü is 2 bytes, it must not be split.
+	assert.Equal(t, "Z", truncateName("Zürich", 2))
+	assert.Equal(t, "Zü", truncateName("Zürich", 3))
+}
+
+func TestAppendMeasurement(t *testing.T) {
+	for m, expected := range map[measurement]string{
+		0:    "0.0",
+		5:    "0.5",
+		-5:   "-0.5",
+		123:  "12.3",
+		-999: "-99.9",
+		999:  "99.9",
+	} {
+		assert.Equal(t, expected, string(appendMeasurement(nil, m)))
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	opts := generateOptions{rows: 3*generateBlockRows + 123, stations: 10_000, seed: 1, workers: 1}
+	var expected bytes.Buffer
+	require.NoError(t, generate(&expected, opts))
+
+	require.NoError(t, defaultLineFormat.validate(expected.Bytes()))
+	lines := strings.Split(strings.TrimSuffix(expected.String(), "\n"), "\n")
+	assert.Len(t, lines, int(opts.rows))
+	for _, line := range lines {
+		_, value, _ := strings.Cut(line, ";")
+		temperature, err := strconv.ParseFloat(value, 64)
+		require.NoError(t, err)
+		assert.True(t, temperature >= -99.9 && temperature <= 99.9, line)
+	}
+
+	// The output doesn't depend on the number of workers.
+	for _, workers := range []int{2, 7} {
+		opts.workers = workers
+		var actual bytes.Buffer
+		require.NoError(t, generate(&actual, opts))
+		assert.Equal(t, expected.Bytes(), actual.Bytes(), "workers: %d", workers)
+	}
+
+	// Different seed generates different file.
+	opts.seed = 2
+	var other bytes.Buffer
+	require.NoError(t, generate(&other, opts))
+	assert.NotEqual(t, expected.Bytes(), other.Bytes())
+}
+
+func TestParseRows(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"0":         0,
+		"1000":      1000,
+		"1e9":       1_000_000_000,
+		"1_000_000": 1_000_000,
+		"2.5e3":     2500,
+	} {
+		rows, err := parseRows(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, rows, s)
+	}
+	for _, s := range []string{"", "x", "1.5", "-1", "1e30"} {
+		_, err := parseRows(s)
+		assert.ErrorIs(t, err, errInvalidGenerateOptions, s)
+	}
+}
+
+func TestGenerateCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "measurements.txt")
+	require.NoError(t, generateCommand([]string{"--rows", "1e3", "--stations", "10", "--seed", "7", "-o", file}, io.Discard, io.Discard))
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, bytes.Count(data, []byte("\n")))
+
+	opts := defaultOptions()
+	opts.file = file
+	stationData, err := aggregateFile(opts)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, stationData.len(), 10)
+
+	var stdout bytes.Buffer
+	require.NoError(t, generateCommand([]string{"--rows", "1e3", "--stations", "10", "--seed", "7"}, &stdout, io.Discard))
+	assert.Equal(t, data, stdout.Bytes())
+
+	reference := filepath.Join(t.TempDir(), "measurements.out")
+	require.NoError(t, generateCommand([]string{"--rows", "1e4", "--profile", "collisions", "--reference", reference, "-o", file}, io.Discard, io.Discard))
+	require.NoError(t, verifyCommand([]string{file, reference}, io.Discard, io.Discard))
+
+	// The collisions don't depend on the random hashSeed of the process.
+	defer func(seed uint32) { hashSeed = seed }(hashSeed)
+	var collisions [2]bytes.Buffer
+	for i, seed := range []uint32{1, 2} {
+		hashSeed = seed
+		require.NoError(t, generateCommand([]string{"--rows", "1e3", "--profile", "collisions"}, &collisions[i], io.Discard))
+	}
+	assert.Equal(t, collisions[0].String(), collisions[1].String())
+	hashSeed = 1
+	require.NoError(t, generateCommand([]string{"--rows", "1e3", "--profile", "collisions", "--hash-seed", "7"}, io.Discard, io.Discard))
+	assert.Equal(t, uint32(7), hashSeed)
+
+	assert.Error(t, generateCommand([]string{"--profile", "nope"}, io.Discard, io.Discard))
+	assert.Error(t, generateCommand([]string{"--rows", "many"}, io.Discard, io.Discard))
+	assert.Error(t, generateCommand([]string{"extra"}, io.Discard, io.Discard))
+}
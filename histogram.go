@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+)
+
+// histogramBins are 1°C wide bins covering the whole [-99.9,99.9] range.
+const histogramBins = 200
+
+var errHistogramCheckpoint = errors.New("--histogram can't be used with --checkpoint, checkpoints don't keep histograms")
+
+// histogram counts the measurements of the station per 1°C bin,
+// bin 0 is [-100,-99), bin 199 is [99,100).
+type histogram [histogramBins]countT
+
+func histogramBin(m measurement) int {
+	// Measurements are *10, so +1000 makes them positive before the
+	// division and the bins are floored also for the negative ones.
+	return min(max((int(m)+1000)/10, 0), histogramBins-1)
+}
+
+func (h *histogram) merge(other *histogram) {
+	for i, count := range other {
+		h[i] += count
+	}
+}
+
+// histograms are kept next to the stats instead of in them, so the
+// stats stay pointer free and GC doesn't scan them on the default path.
+type histograms map[stationName]*histogram
+
+func (h histograms) merge(other histograms) {
+	for name, hist := range other {
+		sumHist, ok := h[name]
+		if !ok {
+			sumHist = &histogram{}
+			h[name] = sumHist
+		}
+		sumHist.merge(hist)
+	}
+}
+
+// histogramChunkReader is chunkReader which also collects the histogram
+// of each station. It is a separate loop so the default path doesn't pay
+// for the histograms (800 bytes per station) when they are not needed,
+// this one pays for the extra Go map lookup per line.
+func histogramChunkReader(chunks chan chunk, format lineFormat) simpleMap {
+	var (
+		out = newSimpleMap(maxStations)
+
+		names nameArena
+		hist  *histogram
+
+		fixedOffset = format.fixedOffset()
+		delimiter   = format.delimiter[0]
+	)
+	out.hists = histograms{}
+
+	for chunk := range chunks {
+		var (
+			chunkView = chunk.data
+
+			newlineIdx  int
+			name        stationName
+			measurement measurement
+		)
+		for {
+			if fixedOffset {
+				newlineIdx, name, measurement = parseLine(chunkView, delimiter)
+			} else {
+				newlineIdx, name, measurement = parseLineGeneric(chunkView, format)
+			}
+			if newlineIdx == -1 {
+				break
+			}
+
+			pos := out.pos(name)
+			stationStats, ok := out.get(pos, name)
+			if ok {
+				hist = out.hists[name]
+			} else {
+				stationStats, hist = &stats{}, &histogram{}
+				name = names.intern(name)
+				out.set(pos, name, stationStats)
+				out.hists[name] = hist
+			}
+			updateStats(stationStats, measurement)
+			hist[histogramBin(measurement)]++
+			// Save next line's start at current index+1 (step over \n).
+			chunkView = chunkView[newlineIdx+1:]
+		}
+		chunk.release()
+	}
+
+	return out
+}
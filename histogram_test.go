@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramBin(t *testing.T) {
+	assert.Equal(t, 0, histogramBin(-999))
+	assert.Equal(t, 0, histogramBin(-991))
+	assert.Equal(t, 99, histogramBin(-1))
+	assert.Equal(t, 100, histogramBin(0))
+	assert.Equal(t, 100, histogramBin(9))
+	assert.Equal(t, 101, histogramBin(10))
+	assert.Equal(t, 199, histogramBin(999))
+}
+
+// TestStatsSize guards the stats against growing a histogram pointer
+// again, the default path would pay for it in memory and GC scanning.
+func TestStatsSize(t *testing.T) {
+	assert.Equal(t, uintptr(16), unsafe.Sizeof(stats{}))
+}
+
+func TestHistogramChunkReader(t *testing.T) {
+	want := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+
+	// Merged from single chunk maps, so the histograms are merged too.
+	got := newSimpleMap(maxStations)
+	for c := range chunkByBytes(bytes.NewReader(testData), 32) {
+		single := make(chan chunk, 1)
+		single <- c
+		close(single)
+		sumChunk(&got, histogramChunkReader(single, defaultLineFormat))
+	}
+
+	require.Equal(t, want.len(), got.len())
+	for pos, item := range want.Iter() {
+		st, ok := got.get(pos, item.name)
+		require.True(t, ok, item.name)
+		hist := got.hists[item.name]
+		require.NotNil(t, hist, item.name)
+
+		var count countT
+		for _, binCount := range hist {
+			count += binCount
+		}
+		assert.Equal(t, item.stats.count, count, item.name)
+		assert.Equal(t, *item.stats, *st, item.name)
+	}
+
+	// Ljubljana: 24.3, -24.3, 0.0, -0.1
+	ljubljana := got.hists["Ljubljana"]
+	assert.Equal(t, countT(1), ljubljana[75])
+	assert.Equal(t, countT(1), ljubljana[99])
+	assert.Equal(t, countT(1), ljubljana[100])
+	assert.Equal(t, countT(1), ljubljana[124])
+}
+
+func TestParseOptionsHistogram(t *testing.T) {
+	var out bytes.Buffer
+	opts, err := parseOptions([]string{"--histogram", "--format", "html"}, &out)
+	require.NoError(t, err)
+	assert.True(t, opts.histogram)
+
+	_, err = parseOptions([]string{"--histogram", "--checkpoint", "x.ckpt"}, &out)
+	assert.ErrorIs(t, err, errHistogramCheckpoint)
+	_, err = parseOptions([]string{"--histogram", "--format", "csv", "--window", "1h"}, &out)
+	assert.ErrorIs(t, err, errInvalidWindow)
+}
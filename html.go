@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// The HTML report is a single file without any external resources,
+// so it can be sent around and opened offline. The charts are inline
+// SVG drawn here, the script only sorts the table.
+const (
+	htmlChartWidth  = 240
+	htmlChartHeight = 16
+)
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>1BRC report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: 2px 10px; border-bottom: 1px solid #eee; }
+th { position: sticky; top: 0; background: #f6f6f6; cursor: pointer; user-select: none; text-align: left; }
+th.asc::after { content: " ▲"; }
+th.desc::after { content: " ▼"; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+svg { display: block; }
+.range { stroke: #4a90d9; stroke-width: 4; }
+.mean { fill: #d9534f; }
+.zero { stroke: #bbb; stroke-width: 1; }
+.hist { fill: #5cb85c; }
+</style>
+</head>
+<body>
+<h1>1BRC report</h1>
+<p>{{.Stations}} stations, {{.Measurements}} measurements, from {{.Min}} °C to {{.Max}} °C.
+Click the column header to sort.</p>
+<table>
+<thead>
+<tr>
+<th data-sort="string">Station</th>
+<th data-sort="number">Min</th>
+<th data-sort="number">Mean</th>
+<th data-sort="number">Max</th>
+<th data-sort="number">Count</th>
+<th>Range {{.Min}} … {{.Max}} °C</th>
+{{- if .Histograms}}
+<th>Histogram (1 °C bins)</th>
+{{- end}}
+</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr><td>{{.Station}}</td><td class="num">{{.Min}}</td><td class="num">{{.Mean}}</td><td class="num">{{.Max}}</td><td class="num">{{.Count}}</td><td>{{.Range}}</td>{{if $.Histograms}}<td>{{.Histogram}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("th[data-sort]").forEach(th => th.addEventListener("click", () => {
+  const tbody = th.closest("table").tBodies[0];
+  const col = th.cellIndex;
+  const numeric = th.dataset.sort === "number";
+  const dir = th.classList.contains("asc") ? -1 : 1;
+  th.parentNode.querySelectorAll("th").forEach(other => other.classList.remove("asc", "desc"));
+  th.classList.add(dir === 1 ? "asc" : "desc");
+  const value = row => row.cells[col].textContent;
+  const rows = Array.from(tbody.rows);
+  rows.sort((a, b) => dir * (numeric ? parseFloat(value(a)) - parseFloat(value(b)) : value(a).localeCompare(value(b))));
+  const sorted = document.createDocumentFragment();
+  rows.forEach(row => sorted.appendChild(row));
+  tbody.appendChild(sorted);
+}));
+</script>
+</body>
+</html>
+`))
+
+type htmlRow struct {
+	Station          string
+	Min, Mean, Max   string
+	Count            countT
+	Range, Histogram template.HTML
+}
+
+type htmlReport struct {
+	Stations     int
+	Measurements uint64
+	Min, Max     string
+	Histograms   bool
+	Rows         []htmlRow
+}
+
+// htmlScale maps the temperature to x coordinate of the charts,
+// all the rows share the same scale so they can be compared.
+type htmlScale struct {
+	lo, hi float64
+}
+
+func (s htmlScale) x(v float64) float64 {
+	if s.hi == s.lo {
+		return htmlChartWidth / 2
+	}
+	return (v - s.lo) / (s.hi - s.lo) * htmlChartWidth
+}
+
+// rangeChart draws line from min to max with a dot at the mean.
+func (s htmlScale) rangeChart(st *stats) template.HTML {
+	var (
+		y    = htmlChartHeight / 2
+		svg  strings.Builder
+		minX = s.x(correctMagnitude(st.min))
+		maxX = s.x(correctMagnitude(st.max))
+	)
+	fmt.Fprintf(&svg, `<svg width="%d" height="%d">`, htmlChartWidth, htmlChartHeight)
+	if s.lo < 0 && s.hi > 0 {
+		fmt.Fprintf(&svg, `<line class="zero" x1="%.1f" y1="0" x2="%.1f" y2="%d"/>`, s.x(0), s.x(0), htmlChartHeight)
+	}
+	// Zero length line is not drawn, so keep it at least 1px.
+	minX = min(minX, htmlChartWidth-1)
+	fmt.Fprintf(&svg, `<line class="range" x1="%.1f" y1="%d" x2="%.1f" y2="%d"/>`, minX, y, max(maxX, minX+1), y)
+	fmt.Fprintf(&svg, `<circle class="mean" cx="%.1f" cy="%d" r="4"/>`, s.x(mean(st.sum, st.count)), y)
+	svg.WriteString(`</svg>`)
+	// Built only from numbers, so it is safe to not escape.
+	return template.HTML(svg.String())
+}
+
+// histogramChart draws the bins between loBin and hiBin as a single path,
+// bars are relative to the station's largest bin.
+func histogramChart(hist *histogram, loBin, hiBin int) template.HTML {
+	var largest countT
+	for _, count := range hist {
+		largest = max(largest, count)
+	}
+	var (
+		svg   strings.Builder
+		width = float64(htmlChartWidth) / float64(hiBin-loBin+1)
+	)
+	fmt.Fprintf(&svg, `<svg width="%d" height="%d"><path class="hist" d="`, htmlChartWidth, 2*htmlChartHeight)
+	for bin := loBin; bin <= hiBin && largest > 0; bin++ {
+		if hist[bin] == 0 {
+			continue
+		}
+		height := float64(hist[bin]) / float64(largest) * 2 * htmlChartHeight
+		fmt.Fprintf(&svg, "M%.1f %dv%.1fh%.1fv%.1fz", float64(bin-loBin)*width, 2*htmlChartHeight, -height, width, height)
+	}
+	svg.WriteString(`"/></svg>`)
+	return template.HTML(svg.String())
+}
+
+// writeHTML writes the self-contained HTML report.
+func writeHTML(writer io.Writer, sumStationData simpleMap) error {
+	var (
+		rows   = outputRows(sumStationData, window{})
+		report = htmlReport{Stations: len(rows), Histograms: len(rows) > 0}
+		scale  htmlScale
+		// loBin and hiBin are the first and last non-empty bins of
+		// all the stations, so the histograms don't waste space.
+		loBin, hiBin = histogramBins - 1, 0
+	)
+	for i, row := range rows {
+		lo, hi := correctMagnitude(row.stats.min), correctMagnitude(row.stats.max)
+		if i == 0 || lo < scale.lo {
+			scale.lo = lo
+		}
+		if i == 0 || hi > scale.hi {
+			scale.hi = hi
+		}
+		report.Measurements += uint64(row.stats.count)
+		if sumStationData.hists[row.name] == nil {
+			report.Histograms = false
+			continue
+		}
+		loBin = min(loBin, histogramBin(measurement(row.stats.min)))
+		hiBin = max(hiBin, histogramBin(measurement(row.stats.max)))
+	}
+	report.Min, report.Max = formatFloat(scale.lo), formatFloat(scale.hi)
+
+	report.Rows = make([]htmlRow, len(rows))
+	for i, row := range rows {
+		report.Rows[i] = htmlRow{
+			Station: string(row.name),
+			Min:     formatFloat(correctMagnitude(row.stats.min)),
+			Mean:    formatFloat(mean(row.stats.sum, row.stats.count)),
+			Max:     formatFloat(correctMagnitude(row.stats.max)),
+			Count:   row.stats.count,
+			Range:   scale.rangeChart(row.stats),
+		}
+		if report.Histograms {
+			report.Rows[i].Histogram = histogramChart(sumStationData.hists[row.name], loBin, hiBin)
+		}
+	}
+	return htmlReportTemplate.Execute(writer, report)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHTML(t *testing.T) {
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(append(testData, "<b>Bad</b>;1.0\n"...)), 32), defaultLineFormat)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, options{output: formatHTML}))
+	report := buf.String()
+
+	assert.True(t, strings.HasPrefix(report, "<!DOCTYPE html>"))
+	assert.Contains(t, report, "11 stations, 14 measurements, from -24.3 °C to 46.2 °C.")
+	assert.Contains(t, report, `<tr><td>Ljubljana</td><td class="num">-24.3</td><td class="num">0.0</td><td class="num">24.3</td><td class="num">4</td><td><svg`)
+	assert.Contains(t, report, "<td>&lt;b&gt;Bad&lt;/b&gt;</td>")
+	assert.Equal(t, 11, strings.Count(report, `<circle class="mean"`))
+	assert.NotContains(t, report, "Histogram")
+	// Everything is inline, the report has to work offline.
+	assert.NotContains(t, report, "http")
+	assert.NotContains(t, report, " src=")
+}
+
+func TestWriteHTMLHistogram(t *testing.T) {
+	opts := defaultOptions()
+	opts.output = formatHTML
+	opts.histogram = true
+	stationData, err := aggregate(bytes.NewReader(testData), opts)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, opts))
+	report := buf.String()
+
+	assert.Contains(t, report, "<th>Histogram (1 °C bins)</th>")
+	assert.Equal(t, 10, strings.Count(report, `<path class="hist"`))
+	// Bins from -25 °C to 47 °C, Ljubljana's 4 bins are all the same height.
+	assert.Contains(t, report, `<td><svg width="240" height="32"><path class="hist" d="M0.0 32v-32.0h3.3v32.0zM80.0 32v-32.0h3.3v32.0zM83.3 32v-32.0h3.3v32.0zM163.3 32v-32.0h3.3v32.0z"/></svg></td>`)
+}
+
+func TestWriteHTMLEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeHTML(&buf, newSimpleMap(maxStations)))
+	assert.Contains(t, buf.String(), "0 stations, 0 measurements")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// lineFormat describes the layout of a single line
+// `<station><delimiter><measurement>\n` where the measurement
+// uses decimalSep between the integer and fractional digit.
+type lineFormat struct {
+	delimiter  string
+	decimalSep string
+
+	// delimiterBytes is cached so the generic parser does not
+	// have to convert the delimiter on each line.
+	delimiterBytes []byte
+}
+
+var errInvalidLineFormat = errors.New("invalid line format")
+
+var defaultLineFormat = lineFormat{
+	delimiter:      ";",
+	decimalSep:     ".",
+	delimiterBytes: []byte(";"),
+}
+
+func newLineFormat(delimiter, decimalSep string) (lineFormat, error) {
+	if delimiter == "" || decimalSep == "" {
+		return lineFormat{}, fmt.Errorf("%w: delimiter and decimal separator must not be empty", errInvalidLineFormat)
+	}
+	if strings.ContainsAny(delimiter, "\n-0123456789") || strings.ContainsAny(decimalSep, "\n-0123456789") {
+		return lineFormat{}, fmt.Errorf("%w: delimiter: %q and decimal separator: %q must not contain newline, '-' or digits", errInvalidLineFormat, delimiter, decimalSep)
+	}
+	if strings.Contains(delimiter, decimalSep) || strings.Contains(decimalSep, delimiter) {
+		return lineFormat{}, fmt.Errorf("%w: delimiter: %q and decimal separator: %q are ambiguous", errInvalidLineFormat, delimiter, decimalSep)
+	}
+	return lineFormat{
+		delimiter:      delimiter,
+		decimalSep:     decimalSep,
+		delimiterBytes: []byte(delimiter),
+	}, nil
+}
+
+// fixedOffset reports if parseLine can be used. With single byte
+// delimiter and decimal separator the measurement is always 3-5 bytes
+// long, so we can find the delimiter by offset from the `\n`.
+// parseNumber skips the decimal separator so any single byte works.
+func (f lineFormat) fixedOffset() bool {
+	return len(f.delimiter) == 1 && len(f.decimalSep) == 1
+}
+
+// parseLineGeneric is the slow path of parseLine for multi-byte
+// delimiters or decimal separators (e.g. `::` or Arabic `٫`).
+func parseLineGeneric(data []byte, format lineFormat) (int, stationName, measurement) {
+	newlineIdx := bytes.IndexByte(data, '\n')
+	if newlineIdx == -1 {
+		return -1, "", 0
+	}
+
+	line := data[:newlineIdx]
+	separatorIdx := bytes.LastIndex(line, format.delimiterBytes)
+	if separatorIdx == -1 {
+		return -1, "", 0
+	}
+	number := line[separatorIdx+len(format.delimiterBytes):]
+	if len(number) < 2+len(format.decimalSep) {
+		return -1, "", 0
+	}
+
+	var name stationName
+	if separatorIdx > 0 {
+		name = stationName(unsafe.String(&data[0], separatorIdx))
+	}
+	return newlineIdx, name, parseNumberGeneric(number, len(format.decimalSep))
+}
+
+// parseNumberGeneric parses `[-]d[d]<sep>d` where sep is sepLen bytes long.
+func parseNumberGeneric(number []byte, sepLen int) measurement {
+	var (
+		negative bool
+		n        measurement
+	)
+	if number[0] == '-' {
+		negative = true
+		number = number[1:]
+	}
+	integer := number[:len(number)-sepLen-1]
+	for _, digit := range integer {
+		n = 10*n + measurement(digit-48)
+	}
+	n = 10*n + measurement(number[len(number)-1]-48)
+	if negative {
+		return -n
+	}
+	return n
+}
+
+// maxStationNameLen is the 1BRC spec limit in bytes.
+const maxStationNameLen = 100
+
+// validate checks every line of the data, so it can be safely parsed
+// with parseLine or parseLineGeneric which trust the layout. It is used
+// for untrusted input, the measurements files skip it for speed.
+func (f lineFormat) validate(data []byte) error {
+	for lineNum := 1; len(data) > 0; lineNum++ {
+		newlineIdx := bytes.IndexByte(data, '\n')
+		if newlineIdx == -1 {
+			return fmt.Errorf("line %d: missing newline at the end", lineNum)
+		}
+		line := data[:newlineIdx]
+		data = data[newlineIdx+1:]
+
+		separatorIdx := bytes.Index(line, f.delimiterBytes)
+		if separatorIdx == -1 {
+			return fmt.Errorf("line %d: missing delimiter %q: %q", lineNum, f.delimiter, line)
+		}
+		name, number := line[:separatorIdx], line[separatorIdx+len(f.delimiterBytes):]
+		if len(name) == 0 || len(name) > maxStationNameLen {
+			return fmt.Errorf("line %d: station name must be 1 to %d bytes: %q", lineNum, maxStationNameLen, line)
+		}
+		if !f.validNumber(number) {
+			return fmt.Errorf("line %d: invalid measurement: %q", lineNum, number)
+		}
+	}
+	return nil
+}
+
+// validNumber checks the `[-]d[d]<sep>d` layout parseNumber expects.
+func (f lineFormat) validNumber(number []byte) bool {
+	number, _ = bytes.CutPrefix(number, []byte("-"))
+	integer, fraction, ok := bytes.Cut(number, []byte(f.decimalSep))
+	if !ok || len(integer) < 1 || len(integer) > 2 || len(fraction) != 1 {
+		return false
+	}
+	return isDigits(integer) && isDigits(fraction)
+}
+
+func isDigits(data []byte) bool {
+	for _, digit := range data {
+		if digit < '0' || digit > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLineFormat(t *testing.T) {
+	_, err := newLineFormat("\t", ",")
+	assert.NoError(t, err)
+
+	_, err = newLineFormat("::", "٫")
+	assert.NoError(t, err)
+
+	_, err = newLineFormat(",", ",")
+	assert.ErrorIs(t, err, errInvalidLineFormat)
+
+	_, err = newLineFormat("", ".")
+	assert.ErrorIs(t, err, errInvalidLineFormat)
+
+	_, err = newLineFormat("-", ".")
+	assert.ErrorIs(t, err, errInvalidLineFormat)
+}
+
+func TestParseLineDelimiter(t *testing.T) {
+	data := []byte("Bridgetown\t9,3\nÜrümqi\t-0,3\nLjubljana\t-24,3\n")
+
+	newlineIdx, name, msrmnt := parseLine(data, '\t')
+	assert.Equal(t, 14, newlineIdx)
+	assert.Equal(t, stationName("Bridgetown"), name)
+	assert.Equal(t, measurement(93), msrmnt)
+
+	data = data[newlineIdx+1:]
+	newlineIdx, name, msrmnt = parseLine(data, '\t')
+	assert.Equal(t, 13, newlineIdx)
+	assert.Equal(t, stationName("Ürümqi"), name)
+	assert.Equal(t, measurement(-3), msrmnt)
+
+	data = data[newlineIdx+1:]
+	newlineIdx, name, msrmnt = parseLine(data, '\t')
+	assert.Equal(t, 15, newlineIdx)
+	assert.Equal(t, stationName("Ljubljana"), name)
+	assert.Equal(t, measurement(-243), msrmnt)
+}
+
+func TestParseLineGeneric(t *testing.T) {
+	format, err := newLineFormat("::", "٫")
+	require.NoError(t, err)
+	data := []byte("Bridgetown::9٫3\nÜrümqi::-0٫3\nLjubljana::-24٫3\n")
+
+	newlineIdx, name, msrmnt := parseLineGeneric(data, format)
+	assert.Equal(t, 16, newlineIdx)
+	assert.Equal(t, stationName("Bridgetown"), name)
+	assert.Equal(t, measurement(93), msrmnt)
+
+	data = data[newlineIdx+1:]
+	newlineIdx, name, msrmnt = parseLineGeneric(data, format)
+	assert.Equal(t, 15, newlineIdx)
+	assert.Equal(t, stationName("Ürümqi"), name)
+	assert.Equal(t, measurement(-3), msrmnt)
+
+	data = data[newlineIdx+1:]
+	newlineIdx, name, msrmnt = parseLineGeneric(data, format)
+	assert.Equal(t, 17, newlineIdx)
+	assert.Equal(t, stationName("Ljubljana"), name)
+	assert.Equal(t, measurement(-243), msrmnt)
+
+	newlineIdx, _, _ = parseLineGeneric(data[newlineIdx+1:], format)
+	assert.Equal(t, -1, newlineIdx)
+}
+
+func TestChunkReaderLineFormat(t *testing.T) {
+	formats := []struct {
+		delimiter, decimalSep string
+	}{
+		{"|", ","},
+		{"\t", ","},
+		{"::", "."},
+		{";", "٫"},
+	}
+	want := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+
+	for _, f := range formats {
+		format, err := newLineFormat(f.delimiter, f.decimalSep)
+		require.NoError(t, err)
+
+		data := bytes.ReplaceAll(testData, []byte("."), []byte(f.decimalSep))
+		data = bytes.ReplaceAll(data, []byte(";"), []byte(f.delimiter))
+		got := chunkReader(chunkByBytes(bytes.NewReader(data), 32), format)
+
+		require.Equal(t, want.len(), got.len(), "format: %+v", f)
+		for pos, item := range want.Iter() {
+			gotStats, ok := got.get(pos, item.name)
+			require.True(t, ok, "format: %+v, key: %s is not present in output", f, item.name)
+			assert.Equal(t, *item.stats, *gotStats, "format: %+v", f)
+		}
+	}
+}
+
+func TestLineFormatValidate(t *testing.T) {
+	assert.NoError(t, defaultLineFormat.validate(testData))
+	assert.NoError(t, defaultLineFormat.validate(nil))
+
+	invalid := []string{
+		"Hamburg;12.0",
+		"Hamburg 12.0\n",
+		";12.0\n",
+		"Hamburg;;12.0\n",
+		"Hamburg;120\n",
+		"Hamburg;120.0\n",
+		"Hamburg;12.05\n",
+		"Hamburg;-1a.0\n",
+		"Hamburg;--1.0\n",
+		"Hamburg;12,0\n",
+		"ab\n",
+		"\n",
+		string(bytes.Repeat([]byte("a"), maxStationNameLen+1)) + ";1.0\n",
+	}
+	for _, line := range invalid {
+		assert.Error(t, defaultLineFormat.validate([]byte(line)), "%q", line)
+	}
+
+	format, err := newLineFormat("::", "٫")
+	require.NoError(t, err)
+	assert.NoError(t, format.validate([]byte("Hamburg::-12٫0\nA::1٫0\n")))
+	assert.Error(t, format.validate([]byte("Hamburg::12.0\n")))
+}
+
+// FuzzValidate feeds arbitrary bytes to the validating path of the
+// ingest endpoint, validate must not panic and whatever it accepts must
+// be parsed by chunkReader the same as by the reference parser.
+func FuzzValidate(f *testing.F) {
+	formats := []struct {
+		delimiter, decimalSep string
+	}{
+		{";", "."},
+		{"|", ","},
+		{"::", "."},
+		{";", "٫"},
+	}
+	f.Add(testData, uint8(0))
+	f.Add([]byte("Hamburg|-1,0\nA|99,9\n"), uint8(1))
+	f.Add([]byte("Hamburg::-12.0\nA::1.0\n"), uint8(2))
+	f.Add([]byte("Hamburg;-12٫0\nA;1٫0\n"), uint8(3))
+	f.Add([]byte(";;;\n-;-.-\n"), uint8(0))
+	f.Fuzz(func(t *testing.T, data []byte, formatIdx uint8) {
+		layout := formats[int(formatIdx)%len(formats)]
+		format, err := newLineFormat(layout.delimiter, layout.decimalSep)
+		require.NoError(t, err)
+		if format.validate(data) != nil {
+			return
+		}
+
+		want, err := referenceAggregate(data, layout.delimiter, layout.decimalSep)
+		require.NoError(t, err, "validated input must be parsable")
+		chunks := make(chan chunk, 1)
+		chunks <- chunk{data: data}
+		close(chunks)
+		assertSameStations(t, want, chunkReader(chunks, format))
+	})
+}
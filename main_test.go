@@ -2,6 +2,10 @@ package main
 
 import (
 	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -72,21 +76,21 @@ func TestParseLine(t *testing.T) {
 Ljubljana;-24.3
 `)
 
-	newlineIdx, name, msrmnt := parseLine(data)
+	newlineIdx, name, msrmnt := parseLine(data, ';')
 
 	assert.Equal(t, 14, newlineIdx)
 	assert.Equal(t, stationName("Bridgetown"), name)
 	assert.Equal(t, measurement(93), msrmnt)
 
 	data = data[newlineIdx+1:]
-	newlineIdx, name, msrmnt = parseLine(data)
+	newlineIdx, name, msrmnt = parseLine(data, ';')
 
 	assert.Equal(t, 13, newlineIdx)
 	assert.Equal(t, stationName("Ürümqi"), name)
 	assert.Equal(t, measurement(-3), msrmnt)
 
 	data = data[newlineIdx+1:]
-	newlineIdx, name, msrmnt = parseLine(data)
+	newlineIdx, name, msrmnt = parseLine(data, ';')
 
 	assert.Equal(t, 15, newlineIdx)
 	assert.Equal(t, stationName("Ljubljana"), name)
@@ -108,7 +112,7 @@ func BenchmarkParseLine(b *testing.B) {
 	data := testData
 
 	for range b.N {
-		newlineIdx, name, msrmnt = parseLine(data)
+		newlineIdx, name, msrmnt = parseLine(data, ';')
 	}
 
 	NewlineIdx = newlineIdx
@@ -180,7 +184,7 @@ func TestChunkReader(t *testing.T) {
 		},
 	}
 	chunksChan := chunkByBytes(bytes.NewReader(testData), 32)
-	got := chunkReader(chunksChan)
+	got := chunkReader(chunksChan, defaultLineFormat)
 
 	for k, v := range want {
 		pos := got.pos(k)
@@ -260,8 +264,8 @@ func TestSumStationData(t *testing.T) {
 	chunk1.set(pos, "station", &stats{min: -10, max: 10, sum: 10, count: 2})
 	chunk2 := newSimpleMap(10)
 	chunk2.set(pos, "station", &stats{min: 0, max: 20, sum: -10, count: 2})
-	sumChunk(got, chunk1)
-	sumChunk(got, chunk2)
+	sumChunk(&got, chunk1)
+	sumChunk(&got, chunk2)
 
 	wantStats, ok := want.get(pos, "station")
 	require.True(t, ok)
@@ -298,10 +302,11 @@ func TestSimpleMapSet(t *testing.T) {
 			{
 				name:  "testname",
 				stats: &st,
+				hash:  pos,
 			},
 		},
 	}
-	assert.Equal(t, expect, m.data[pos])
+	assert.Equal(t, expect, m.data[pos%uint32(m.capacity)])
 
 	st = stats{sum: 20, min: 20, max: 20, count: 2}
 	m.set(pos, "testname", &st)
@@ -311,10 +316,11 @@ func TestSimpleMapSet(t *testing.T) {
 			{
 				name:  "testname",
 				stats: &st,
+				hash:  pos,
 			},
 		},
 	}
-	assert.Equal(t, expect, m.data[pos])
+	assert.Equal(t, expect, m.data[pos%uint32(m.capacity)])
 }
 
 func TestSimpleMapGet(t *testing.T) {
@@ -322,11 +328,12 @@ func TestSimpleMapGet(t *testing.T) {
 	pos := m.pos("testname")
 
 	st := stats{sum: 10, min: 10, max: 10, count: 1}
-	m.data[pos] = bucket{
+	m.data[pos%uint32(m.capacity)] = bucket{
 		items: []bucketItem{
 			{
 				name:  "testname",
 				stats: &st,
+				hash:  pos,
 			},
 		},
 	}
@@ -358,6 +365,337 @@ func BenchmarkStationIdx(b *testing.B) {
 func BenchmarkRun(b *testing.B) {
 	bench = true
 	for range b.N {
-		run(defaultMeasurementsFile)
+		run(defaultOptions())
+	}
+	reportPeakRSS(b)
+}
+
+// reportPeakRSS adds the peak RSS of the whole test process, so it only
+// tells something when the benchmark runs alone in the process.
+func reportPeakRSS(b *testing.B) {
+	if rss := peakRSS(); rss > 0 {
+		b.ReportMetric(float64(rss)/float64(MiB), "peak-RSS-MiB")
+	}
+}
+
+// referenceAggregate is the simplest possible parser, the fuzz
+// targets compare the optimized pipeline against it.
+func referenceAggregate(data []byte, delimiter, decimalSep string) (map[stationName]stats, error) {
+	out := map[stationName]stats{}
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimSuffix(line, "\n"), delimiter)
+		if !ok {
+			return nil, fmt.Errorf("missing delimiter: %q", line)
+		}
+		f, err := strconv.ParseFloat(strings.Replace(value, decimalSep, ".", 1), 64)
+		if err != nil {
+			return nil, err
+		}
+		st := out[stationName(name)]
+		updateStats(&st, measurement(math.Round(f*10)))
+		out[stationName(name)] = st
+	}
+	return out, nil
+}
+
+func assertSameStations(t *testing.T, want map[stationName]stats, got simpleMap) {
+	t.Helper()
+	require.Equal(t, len(want), got.len())
+	for _, item := range got.Iter() {
+		wantStats, ok := want[item.name]
+		require.True(t, ok, "extra station: %q", item.name)
+		require.Equal(t, wantStats, *item.stats, "station: %q", item.name)
+	}
+}
+
+// fuzzMeasurements makes valid measurements out of arbitrary bytes,
+// each `\n` separated piece is a line, its 1st 2 bytes select the
+// value and the rest is the name without the delimiter.
+func fuzzMeasurements(data []byte) []byte {
+	var out []byte
+	for _, piece := range bytes.Split(data, []byte("\n")) {
+		if len(piece) < 3 {
+			continue
+		}
+		m := measurement((int(piece[0])<<8|int(piece[1]))%1999 - 999)
+		name := bytes.ReplaceAll(piece[2:], []byte(";"), nil)
+		name = name[:min(len(name), maxStationNameLen)]
+		if len(name) == 0 {
+			continue
+		}
+		out = append(out, name...)
+		out = append(out, ';')
+		out = appendMeasurement(out, m)
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// FuzzChunkPipeline checks chunkByBytes+chunkReader with random chunk
+// sizes, the chunks must fit at least the longest line, and the claimed
+// chunks of the claim scheduler.
+func FuzzChunkPipeline(f *testing.F) {
+	f.Add([]byte("\x00\x10Hamburg\n\x03\xe7Ürümqi\n\x00\x00Tromsø\n\x07\xcfHamburg\n"), uint16(0))
+	f.Add(bytes.Repeat([]byte("\x01\x02東京\n"), 100), uint16(13))
+	f.Add(bytes.Repeat([]byte("\xff\xffa\n"), 1000), uint16(4000))
+	f.Fuzz(func(t *testing.T, data []byte, size uint16) {
+		var (
+			input     = fuzzMeasurements(data)
+			chunkSize = len(strings.Repeat("a", maxStationNameLen)+";-99.9\n") + int(size)%4096
+		)
+		want, err := referenceAggregate(input, ";", ".")
+		require.NoError(t, err)
+
+		got := chunkReader(chunkByBytes(bytes.NewReader(input), chunkSize), defaultLineFormat)
+		assertSameStations(t, want, got)
+
+		// The claimed ranges can be shorter than the lines.
+		claimed := chunkReader(newChunkClaimer(bytes.NewReader(input), 1+int(size)%4096, nil).chunks(), defaultLineFormat)
+		assertSameStations(t, want, claimed)
+	})
+}
+
+func FuzzParseNumber(f *testing.F) {
+	f.Add(int16(0))
+	f.Add(int16(-999))
+	f.Add(int16(999))
+	f.Fuzz(func(t *testing.T, n int16) {
+		m := measurement(n % 1000)
+		number := appendMeasurement(nil, m)
+		assert.Equal(t, m, parseNumber(number), "%s", number)
+
+		value, err := strconv.ParseFloat(string(number), 64)
+		require.NoError(t, err)
+		assert.Equal(t, m, measurement(math.Round(value*10)), "%s", number)
+	})
+}
+
+// pairStationPos is the previous stationPos, which skipped the trailing
+// byte of odd length names, kept to compare the collisions and speed.
+func pairStationPos(station stationName, capacity int) uint32 {
+	var hash uint32 = 2166136261
+	for i := 0; i+2 <= len(station); i += 2 {
+		hash = hash*16777619 + (uint32(station[i]) | uint32(station[i+1])<<8)
+	}
+	return hash % uint32(capacity)
+}
+
+// bucketCollisions returns how many names share the bucket
+// with other name and the size of the largest bucket.
+func bucketCollisions(names []stationName, hash func(stationName, int) uint32) (int, int) {
+	var (
+		buckets             = map[uint32]int{}
+		collisions, largest int
+	)
+	for _, name := range names {
+		buckets[hash(name, maxStations)]++
+	}
+	for _, count := range buckets {
+		collisions += count - 1
+		largest = max(largest, count)
+	}
+	return collisions, largest
+}
+
+// collisionSets are the reference stations, the 10k unique keys variant
+// and odd length names differing only in the last byte.
+func collisionSets(t testing.TB) map[string][]stationName {
+	sets := map[string][]stationName{}
+	for _, station := range referenceStations {
+		sets["reference"] = append(sets["reference"], stationName(station.name))
+	}
+	stations, err := generateStations(10_000, 42)
+	require.NoError(t, err)
+	for _, station := range stations {
+		sets["10k"] = append(sets["10k"], stationName(station.name))
+	}
+	for c := byte('a'); c <= 'z'; c++ {
+		sets["trailing-byte"] = append(sets["trailing-byte"], stationName("Ab"+string(c)), stationName("Hamburg"+string(c)+"X"+string(c)))
+	}
+	return sets
+}
+
+// TestStationPosCollisions reports the collisions of both hashes,
+// run with -v to see them.
+func TestStationPosCollisions(t *testing.T) {
+	defer func(seed uint32) { hashSeed = seed }(hashSeed)
+	hashSeed = 0
+	for _, set := range []string{"reference", "10k", "trailing-byte"} {
+		names := collisionSets(t)[set]
+		collisions, largest := bucketCollisions(names, stationPos)
+		pairCollisions, pairLargest := bucketCollisions(names, pairStationPos)
+		t.Logf("%-13s %5d names: stationPos %4d collisions (max bucket %d), pairStationPos %4d collisions (max bucket %d)",
+			set, len(names), collisions, largest, pairCollisions, pairLargest)
+
+		switch set {
+		case "reference":
+			// As claimed in stationHash.
+			assert.LessOrEqual(t, collisions, 8)
+			assert.LessOrEqual(t, largest, 3)
+		case "10k":
+			// Uniform hash into maxStations buckets has ~3,679 collisions.
+			assert.LessOrEqual(t, collisions, 3_700)
+			assert.LessOrEqual(t, largest, 7)
+		case "trailing-byte":
+			assert.Equal(t, 26, pairLargest)
+			assert.LessOrEqual(t, largest, 2)
+		}
+	}
+}
+
+func BenchmarkStationPos(b *testing.B) {
+	sets := collisionSets(b)
+	for _, hash := range []struct {
+		name string
+		fn   func(stationName, int) uint32
+	}{
+		{"stationPos", stationPos},
+		{"pairStationPos", pairStationPos},
+	} {
+		for _, set := range []string{"reference", "10k"} {
+			b.Run(hash.name+"/"+set, func(b *testing.B) {
+				names := sets[set]
+				for range b.N {
+					for _, name := range names {
+						Idx = hash.fn(name, maxStations)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestSimpleMapFallback floods a bucket with crafted names, the map has to
+// switch to the fallback and stay usable, also merged with a regular map.
+func TestSimpleMapFallback(t *testing.T) {
+	stations, err := collisionStations(2*maxBucketLen, 1)
+	require.NoError(t, err)
+
+	flooded := newSimpleMap(maxStations)
+	for i, station := range stations {
+		name := stationName(station.name)
+		flooded.set(flooded.pos(name), name, &stats{min: minT(i), max: maxT(i), sum: sumT(i), count: 1})
+		assert.Equal(t, i >= maxBucketLen, flooded.fallback != nil, "station %d", i)
+	}
+	require.Equal(t, len(stations), flooded.len())
+	for i, station := range stations {
+		name := stationName(station.name)
+		st, ok := flooded.get(flooded.pos(name), name)
+		require.True(t, ok, name)
+		assert.Equal(t, countT(1), st.count)
+		assert.Equal(t, sumT(i), st.sum)
+	}
+	for pos, item := range flooded.Iter() {
+		assert.Equal(t, stationHash(item.name), pos)
+	}
+
+	// Merging the flooded map into a regular one floods it too.
+	merged := newSimpleMap(maxStations)
+	merged.set(merged.pos("Hamburg"), "Hamburg", &stats{count: 1})
+	sumChunk(&merged, flooded)
+	sumChunk(&merged, flooded)
+	assert.NotNil(t, merged.fallback)
+	assert.Equal(t, len(stations)+1, merged.len())
+	for _, station := range stations {
+		name := stationName(station.name)
+		st, ok := merged.get(merged.pos(name), name)
+		require.True(t, ok, name)
+		assert.Equal(t, countT(2), st.count)
+	}
+
+	// And the regular map merges into the flooded one.
+	sumChunk(&flooded, merged)
+	assert.Equal(t, len(stations)+1, flooded.len())
+}
+
+// TestHashSeed checks the names crafted to collide with one seed
+// don't collide with another one.
+func TestHashSeed(t *testing.T) {
+	defer func(seed uint32) { hashSeed = seed }(hashSeed)
+
+	hashSeed = 1
+	stations, err := collisionStations(100, 1)
+	require.NoError(t, err)
+	names := make([]stationName, len(stations))
+	for i, station := range stations {
+		names[i] = stationName(station.name)
+	}
+	_, largest := bucketCollisions(names, stationPos)
+	assert.Equal(t, len(names), largest)
+
+	hashSeed = 2
+	_, largest = bucketCollisions(names, stationPos)
+	assert.LessOrEqual(t, largest, 2)
+}
+
+// TestSimpleMapGrow inserts far more stations than the initial capacity,
+// all of them have to stay reachable also while the buckets are moved.
+func TestSimpleMapGrow(t *testing.T) {
+	m := newSimpleMap(16)
+	for i := range 100_000 {
+		name := stationName(fmt.Sprintf("station %d", i))
+		pos := m.pos(name)
+		_, ok := m.get(pos, name)
+		require.False(t, ok, name)
+		m.set(pos, name, &stats{sum: sumT(i), count: 1})
+
+		// Some of the older ones, which can be in the old buckets.
+		old := stationName(fmt.Sprintf("station %d", i/2))
+		st, ok := m.get(m.pos(old), old)
+		require.True(t, ok, "%s after %d", old, i)
+		require.Equal(t, sumT(i/2), st.sum)
+	}
+	assert.Equal(t, 100_000, m.len())
+	assert.GreaterOrEqual(t, m.capacity, 100_000)
+	assert.Nil(t, m.fallback, "growing keeps the buckets short")
+
+	// Stop in the middle of moving the buckets, Iter yields both arrays.
+	for m.old == nil {
+		name := stationName(fmt.Sprintf("station %d", m.len()))
+		m.set(m.pos(name), name, &stats{count: 1})
+	}
+	seen := map[stationName]bool{}
+	for _, item := range m.Iter() {
+		require.False(t, seen[item.name], item.name)
+		seen[item.name] = true
+	}
+	assert.Len(t, seen, m.len())
+}
+
+// TestSumChunkCapacities merges maps which grew to different capacities.
+func TestSumChunkCapacities(t *testing.T) {
+	var (
+		small = newSimpleMap(8)
+		large = newSimpleMap(maxStations)
+		want  = map[stationName]countT{}
+	)
+	for i := range 1000 {
+		name := stationName(fmt.Sprintf("station %d", i))
+		small.set(small.pos(name), name, &stats{count: 1})
+		want[name]++
+		if i%3 == 0 {
+			large.set(large.pos(name), name, &stats{count: 2})
+			want[name] += 2
+		}
+	}
+	require.NotEqual(t, small.capacity, large.capacity)
+
+	for _, dst := range []simpleMap{small, large} {
+		src := large
+		if dst.capacity == large.capacity {
+			src = small
+		}
+		merged := newSimpleMap(dst.capacity)
+		sumChunk(&merged, dst)
+		sumChunk(&merged, src)
+		require.Equal(t, len(want), merged.len())
+		for name, count := range want {
+			st, ok := merged.get(merged.pos(name), name)
+			require.True(t, ok, name)
+			assert.Equal(t, count, st.count, name)
+		}
 	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// stationMap is the map backend of the chunk readers. The name is
+// hashed once by pos and the position is passed to get and set.
+// Iter yields the seeded stationHash of the names, which is valid in
+// any map with the same hashSeed, sumChunk and toSimpleMap pass it
+// to the other map without hashing the name again.
+type stationMap interface {
+	pos(name stationName) uint32
+	get(pos uint32, name stationName) (*stats, bool)
+	set(pos uint32, name stationName, st *stats)
+	len() int
+	Iter() iter.Seq2[uint32, bucketItem]
+}
+
+var (
+	_ stationMap = (*simpleMap)(nil)
+	_ stationMap = stdMap(nil)
+	_ stationMap = (*openMap)(nil)
+)
+
+type mapBackend string
+
+const (
+	mapBackendSimple mapBackend = "simple"
+	// mapBackendGo was slower by 1 second on the full run after the
+	// upgrades in 1.24, BenchmarkMapBackends compares them again.
+	mapBackendGo mapBackend = "go"
+	// mapBackendOpen is the open addressing openMap.
+	mapBackendOpen mapBackend = "open"
+)
+
+var (
+	mapBackends = []mapBackend{mapBackendSimple, mapBackendGo, mapBackendOpen}
+
+	errInvalidMapBackend = errors.New("invalid map backend")
+)
+
+func parseMapBackend(s string) (mapBackend, error) {
+	for _, b := range mapBackends {
+		if string(b) == s {
+			return b, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q, expected one of: %v", errInvalidMapBackend, s, mapBackends)
+}
+
+// stdMap is the Go map backend, it hashes on its own so pos is always 0,
+// only Iter hashes the names for the other maps.
+type stdMap map[stationName]*stats
+
+func (m stdMap) pos(stationName) uint32 {
+	return 0
+}
+
+func (m stdMap) get(_ uint32, name stationName) (*stats, bool) {
+	st, ok := m[name]
+	return st, ok
+}
+
+func (m stdMap) set(_ uint32, name stationName, st *stats) {
+	m[name] = st
+}
+
+func (m stdMap) len() int {
+	return len(m)
+}
+
+func (m stdMap) Iter() iter.Seq2[uint32, bucketItem] {
+	return func(yield func(pos uint32, item bucketItem) bool) {
+		for name, st := range m {
+			if !yield(stationHash(name), bucketItem{name: name, stats: st}) {
+				return
+			}
+		}
+	}
+}
+
+// toSimpleMap copies the stats of other backend into simpleMap,
+// which the merge and all the outputs work with.
+func toSimpleMap(m stationMap) simpleMap {
+	out := newSimpleMap(maxStations)
+	for pos, item := range m.Iter() {
+		out.set(pos, item.name, item.stats)
+	}
+	return out
+}
+
+// backendChunkReader is chunkReader with the selected map backend,
+// the result is converted to simpleMap for the merge.
+func backendChunkReader(backend mapBackend, chunks chan chunk, format lineFormat) simpleMap {
+	switch backend {
+	case mapBackendGo:
+		m := make(stdMap, maxStations)
+		readChunks(chunks, format, m)
+		return toSimpleMap(m)
+	case mapBackendOpen:
+		m := newOpenMap(maxStations)
+		readChunks(chunks, format, m)
+		return toSimpleMap(m)
+	}
+	return chunkReader(chunks, format)
+}
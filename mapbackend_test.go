@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backendStats copies the stats of any backend for comparison.
+func backendStats(m stationMap) map[stationName]stats {
+	out := make(map[stationName]stats, m.len())
+	for _, item := range m.Iter() {
+		out[item.name] = *item.stats
+	}
+	return out
+}
+
+// TestMapBackends runs both backends over the same generated data
+// of every profile and expects identical stats.
+func TestMapBackends(t *testing.T) {
+	for _, profile := range generateProfiles {
+		var data bytes.Buffer
+		require.NoError(t, generate(&data, generateOptions{profile: profile, rows: 50_000, seed: 9, chunkSize: 4 * kiB}))
+
+		for _, size := range []int{4 * kiB, 6 * MiB} {
+			want := chunkReader(chunkByBytes(bytes.NewReader(data.Bytes()), size), defaultLineFormat)
+			for _, backend := range mapBackends[1:] {
+				got := backendChunkReader(backend, chunkByBytes(bytes.NewReader(data.Bytes()), size), defaultLineFormat)
+				require.Equal(t, want.len(), got.len(), "profile: %s, backend: %s", profile.name, backend)
+				assert.Equal(t, backendStats(&want), backendStats(&got), "profile: %s, backend: %s", profile.name, backend)
+			}
+		}
+	}
+}
+
+// TestMapBackendsIterPos checks that Iter of every backend yields
+// positions the other maps accept, sumChunk and toSimpleMap rely on it.
+func TestMapBackendsIterPos(t *testing.T) {
+	// The simpleMap grows from 4 buckets, the other one is in fallback.
+	simple := newSimpleMap(4)
+	fallback := simpleMap{fallback: map[stationName]*stats{}}
+	for _, m := range []stationMap{&simple, &fallback, make(stdMap), newOpenMap(2)} {
+		for i := range 100 {
+			name := stationName(fmt.Sprintf("station %d", i))
+			m.set(m.pos(name), name, &stats{sum: sumT(i), count: 1})
+		}
+		for pos, item := range m.Iter() {
+			assert.Equal(t, stationHash(item.name), pos, "%T", m)
+		}
+	}
+}
+
+func TestAggregateMapBackend(t *testing.T) {
+	var data bytes.Buffer
+	require.NoError(t, generate(&data, generateOptions{rows: 100_000, stations: 10_000, seed: 9}))
+
+	outputs := map[mapBackend]string{}
+	for _, backend := range mapBackends {
+		opts := defaultOptions()
+		opts.mapBackend = backend
+		stationData, err := aggregate(bytes.NewReader(data.Bytes()), opts)
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		require.NoError(t, writeOutput(&out, stationData, opts))
+		outputs[backend] = out.String()
+	}
+	assert.Equal(t, outputs[mapBackendSimple], outputs[mapBackendGo])
+	assert.Equal(t, outputs[mapBackendSimple], outputs[mapBackendOpen])
+}
+
+func TestParseMapBackend(t *testing.T) {
+	opts, err := parseOptions([]string{"--map", "go"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, mapBackendGo, opts.mapBackend)
+
+	_, err = parseOptions([]string{"--map", "swiss"}, io.Discard)
+	assert.ErrorIs(t, err, errInvalidMapBackend)
+	_, err = parseOptions([]string{"--map", "go", "--format", "html", "--histogram"}, io.Discard)
+	assert.ErrorIs(t, err, errInvalidMapBackend)
+}
+
+// BenchmarkMapBackends compares the backends on the reference
+// stations and on the 10k unique keys variant.
+func BenchmarkMapBackends(b *testing.B) {
+	for _, stations := range []int{len(referenceStations), 10_000} {
+		var data bytes.Buffer
+		require.NoError(b, generate(&data, generateOptions{rows: 1_000_000, stations: stations, seed: 1, workers: 1}))
+		chunks := func() chan chunk {
+			c := make(chan chunk, 1)
+			c <- chunk{data: data.Bytes()}
+			close(c)
+			return c
+		}
+
+		b.Run(fmt.Sprintf("%s/%d", mapBackendSimple, stations), func(b *testing.B) {
+			b.SetBytes(int64(data.Len()))
+			for range b.N {
+				m := newSimpleMap(maxStations)
+				readChunks(chunks(), defaultLineFormat, &m)
+			}
+		})
+		b.Run(fmt.Sprintf("%s/%d", mapBackendGo, stations), func(b *testing.B) {
+			b.SetBytes(int64(data.Len()))
+			for range b.N {
+				readChunks(chunks(), defaultLineFormat, make(stdMap, maxStations))
+			}
+		})
+		b.Run(fmt.Sprintf("%s/%d", mapBackendOpen, stations), func(b *testing.B) {
+			b.SetBytes(int64(data.Len()))
+			for range b.N {
+				readChunks(chunks(), defaultLineFormat, newOpenMap(maxStations))
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+type inputBackend string
+
+const (
+	// inputRead reads the chunks into the pooled buffers with ReadAt.
+	inputRead inputBackend = "read"
+	// inputMmap maps the file and the chunks are slices of the mapping.
+	inputMmap inputBackend = "mmap"
+)
+
+var (
+	inputBackends = []inputBackend{inputRead, inputMmap}
+
+	errInvalidInput     = errors.New("invalid input backend")
+	errMmapNotSupported = errors.New("--input mmap is not supported on this platform")
+)
+
+func parseInputBackend(s string) (inputBackend, error) {
+	for _, b := range inputBackends {
+		if string(b) == s {
+			return b, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q, expected one of: %v", errInvalidInput, s, inputBackends)
+}
+
+// mappedInput is the mapped file, split into the ranges of size bytes
+// the same way as chunkClaimer splits it.
+type mappedInput struct {
+	// mapping starts at the page, data at the requested offset.
+	mapping []byte
+	data    []byte
+	size    int
+	next    atomic.Int64
+}
+
+// mmapInput maps the file or the section of it, which is what
+// aggregateFile, the checkpoints and follow mode pass to aggregate.
+func mmapInput(f io.ReaderAt, size int) (*mappedInput, error) {
+	var (
+		off, n             int64
+		section, isSection = f.(*io.SectionReader)
+	)
+	if isSection {
+		f, off, n = section.Outer()
+	}
+	file, ok := f.(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("%w: --input mmap needs a file, got: %T", errInvalidInput, f)
+	}
+	if !isSection {
+		fi, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		n = fi.Size()
+	}
+
+	m := &mappedInput{size: size}
+	if n == 0 {
+		return m, nil
+	}
+	// The mapping has to start at the page boundary.
+	pageOff := off % int64(os.Getpagesize())
+	mapping, err := mmapFile(file, off-pageOff, int(pageOff+n))
+	if err != nil {
+		return nil, err
+	}
+	m.mapping = mapping
+	m.data = mapping[pageOff:]
+	adviseHugePages(m.mapping)
+	return m, nil
+}
+
+func (m *mappedInput) close() error {
+	if m.mapping == nil {
+		return nil
+	}
+	return munmap(m.mapping)
+}
+
+// chunks sends the claimed ranges, shared by all the workers it is the
+// producer, called by every worker each claims its own ranges.
+func (m *mappedInput) chunks() chan chunk {
+	out := make(chan chunk)
+	go func() {
+		defer close(out)
+		for {
+			start := int((m.next.Add(1) - 1) * int64(m.size))
+			if start >= len(m.data) {
+				return
+			}
+			data := mappedRange(m.data, start, m.size)
+			if len(data) == 0 {
+				continue
+			}
+			adviseRange(m.mapping, data)
+			out <- chunk{data: data}
+		}
+	}()
+	return out
+}
+
+// mappedRange returns the lines starting in [start, start+size) of data,
+// including the one crossing the end of the range.
+func mappedRange(data []byte, start, size int) []byte {
+	begin := start
+	if start > 0 {
+		// The byte before the range tells if the first line starts in it.
+		idx := bytes.IndexByte(data[start-1:min(len(data), start+size)], '\n')
+		if idx == -1 || idx == size {
+			return nil
+		}
+		begin = start + idx
+	}
+	end := start + size
+	if end >= len(data) {
+		return data[begin:]
+	}
+	idx := bytes.IndexByte(data[end-1:], '\n')
+	if idx == -1 {
+		return data[begin:]
+	}
+	return data[begin : end+idx]
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func mmapFile(f *os.File, off int64, n int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), off, n, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
+
+// adviseHugePages asks for the transparent huge pages, which the page
+// cache uses only on kernels with the read-only THP for filesystems.
+// It is only the hint, the error is ignored.
+func adviseHugePages(mapping []byte) {
+	_ = syscall.Madvise(mapping, syscall.MADV_HUGEPAGE)
+}
+
+// adviseRange tells the kernel the range is read once from start to end
+// and will be needed right away, so it reads it ahead.
+func adviseRange(mapping, data []byte) {
+	var (
+		page  = uintptr(os.Getpagesize())
+		base  = uintptr(unsafe.Pointer(unsafe.SliceData(mapping)))
+		start = uintptr(unsafe.Pointer(unsafe.SliceData(data)))
+		// madvise needs the page aligned start.
+		from = int((start - base) &^ (page - 1))
+		to   = int(start-base) + len(data)
+	)
+	_ = syscall.Madvise(mapping[from:to], syscall.MADV_SEQUENTIAL)
+	_ = syscall.Madvise(mapping[from:to], syscall.MADV_WILLNEED)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// mmapFile is implemented only on linux, the other
+// platforms keep using the ReadAt input.
+func mmapFile(f *os.File, off int64, n int) ([]byte, error) {
+	return nil, errMmapNotSupported
+}
+
+func munmap(mapping []byte) error {
+	return nil
+}
+
+func adviseHugePages(mapping []byte) {}
+
+func adviseRange(mapping, data []byte) {}
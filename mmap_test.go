@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedRange(t *testing.T) {
+	for _, profile := range generateProfiles {
+		var data bytes.Buffer
+		require.NoError(t, generate(&data, generateOptions{profile: profile, rows: 1000, seed: 7, chunkSize: 4 * kiB}))
+
+		for _, size := range []int{1, 7, 127, 4 * kiB, 4*kiB + 1, 6 * MiB} {
+			var got []byte
+			for start := 0; start < data.Len(); start += size {
+				got = append(got, mappedRange(data.Bytes(), start, size)...)
+			}
+			assert.Equal(t, data.Bytes(), got, "profile: %s, size: %d", profile.name, size)
+		}
+	}
+	assert.Equal(t, []byte("Abc;2.0"), mappedRange([]byte("Hamburg;1.0\nAbc;2.0"), 5, 10))
+}
+
+// writeGenerated writes the generated file into the test's temp dir.
+func writeGenerated(tb testing.TB, opts generateOptions) (string, []byte) {
+	tb.Helper()
+	var data bytes.Buffer
+	require.NoError(tb, generate(&data, opts))
+	file := filepath.Join(tb.TempDir(), "measurements.txt")
+	require.NoError(tb, os.WriteFile(file, data.Bytes(), 0o644))
+	return file, data.Bytes()
+}
+
+func TestAggregateInput(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip(errMmapNotSupported)
+	}
+	file, data := writeGenerated(t, generateOptions{rows: 100_000, stations: 1000, seed: 10})
+
+	defer func(size, readers int) { chunkSize, chunkReaders = size, readers }(chunkSize, chunkReaders)
+	chunkSize, chunkReaders = 16*kiB, 4
+
+	var want bytes.Buffer
+	stationData, err := aggregate(bytes.NewReader(data), defaultOptions())
+	require.NoError(t, err)
+	require.NoError(t, writeOutput(&want, stationData, defaultOptions()))
+
+	for _, input := range inputBackends {
+		for _, sch := range schedulers {
+			opts := defaultOptions()
+			opts.file = file
+			opts.input = input
+			opts.scheduler = sch
+			stationData, err := aggregateFile(opts)
+			require.NoError(t, err)
+
+			var got bytes.Buffer
+			require.NoError(t, writeOutput(&got, stationData, opts))
+			assert.Equal(t, want.String(), got.String(), "input: %s, scheduler: %s", input, sch)
+		}
+	}
+}
+
+// TestAggregateMmapSection maps the sections the checkpoints and
+// follow mode read, which don't start at the page boundary.
+func TestAggregateMmapSection(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip(errMmapNotSupported)
+	}
+	file, data := writeGenerated(t, generateOptions{rows: 10_000, seed: 11})
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var (
+		off  = int64(bytes.IndexByte(data[5000:], '\n') + 5001)
+		opts = defaultOptions()
+	)
+	opts.input = inputMmap
+	for _, n := range []int64{int64(len(data)) - off, 0} {
+		want, err := aggregate(bytes.NewReader(data[off:off+n]), defaultOptions())
+		require.NoError(t, err)
+		got, err := aggregate(io.NewSectionReader(f, off, n), opts)
+		require.NoError(t, err)
+		assert.Equal(t, backendStats(&want), backendStats(&got), "section: %d+%d", off, n)
+	}
+
+	_, err = aggregate(bytes.NewReader(data), opts)
+	assert.ErrorIs(t, err, errInvalidInput)
+}
+
+func TestParseInputBackend(t *testing.T) {
+	opts, err := parseOptions([]string{"--input", "mmap"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, inputMmap, opts.input)
+
+	for _, args := range [][]string{
+		{"--input", "io_uring"},
+		{"--input", "mmap", "--max-memory", "1GiB"},
+		{"--input", "mmap", "--follow"},
+	} {
+		_, err = parseOptions(args, io.Discard)
+		assert.ErrorIs(t, err, errInvalidInput, args)
+	}
+}
+
+// BenchmarkInputs is the matrix of the inputs and schedulers on the just
+// written, page-cached, file. For the cold reads drop the caches and
+// compare the binaries instead, see README.
+func BenchmarkInputs(b *testing.B) {
+	if runtime.GOOS != "linux" {
+		b.Skip(errMmapNotSupported)
+	}
+	file, data := writeGenerated(b, generateOptions{rows: 5_000_000, seed: 1})
+
+	for _, input := range inputBackends {
+		for _, sch := range schedulers {
+			b.Run(fmt.Sprintf("%s/%s", input, sch), func(b *testing.B) {
+				opts := defaultOptions()
+				opts.file = file
+				opts.input = input
+				opts.scheduler = sch
+				b.SetBytes(int64(len(data)))
+				for range b.N {
+					_, err := aggregateFile(opts)
+					require.NoError(b, err)
+				}
+			})
+		}
+	}
+}
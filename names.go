@@ -0,0 +1,28 @@
+package main
+
+import "unsafe"
+
+// nameArenaBlock is big enough for ~4k average names, so a worker
+// usually needs a single block for all the stations.
+var nameArenaBlock = 64 * kiB
+
+// nameArena interns the station names of one worker. parseLine returns
+// names pointing into the chunk data, storing those in the map would keep
+// the whole chunk alive just for a few new names, so each new station's
+// name is copied here on the first insert. The blocks are never
+// reallocated, the interned names stay valid while the map uses them.
+type nameArena struct {
+	block []byte
+}
+
+func (a *nameArena) intern(name stationName) stationName {
+	if len(name) == 0 {
+		return ""
+	}
+	if len(a.block)+len(name) > cap(a.block) {
+		a.block = make([]byte, 0, max(nameArenaBlock, len(name)))
+	}
+	start := len(a.block)
+	a.block = append(a.block, name...)
+	return stationName(unsafe.String(&a.block[start], len(name)))
+}
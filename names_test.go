@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inside reports whether the string points into data.
+func inside(s stationName, data []byte) bool {
+	if len(s) == 0 || len(data) == 0 {
+		return false
+	}
+	p := uintptr(unsafe.Pointer(unsafe.StringData(string(s))))
+	start := uintptr(unsafe.Pointer(&data[0]))
+	return p >= start && p < start+uintptr(len(data))
+}
+
+func TestNameArena(t *testing.T) {
+	var a nameArena
+	data := []byte("Hamburg;12.0\n")
+	name := a.intern(stationName(data[:7]))
+	assert.Equal(t, stationName("Hamburg"), name)
+	assert.False(t, inside(name, data))
+	assert.Equal(t, stationName(""), a.intern(""))
+
+	// The full block starts a new one, the old names stay valid.
+	var names []stationName
+	for i := range 2 * nameArenaBlock / maxStationNameLen {
+		names = append(names, a.intern(stationName(strings.Repeat(string(rune('a'+i%26)), maxStationNameLen))))
+	}
+	for i, name := range names {
+		assert.Equal(t, stationName(strings.Repeat(string(rune('a'+i%26)), maxStationNameLen)), name)
+	}
+	assert.Equal(t, stationName("Hamburg"), name)
+}
+
+// TestReadChunksInternsNames expects none of the names in the maps
+// to point into the chunks, so the chunk buffers can be reused.
+func TestReadChunksInternsNames(t *testing.T) {
+	var data bytes.Buffer
+	require.NoError(t, generate(&data, generateOptions{rows: 10_000, seed: 2}))
+
+	readers := map[string]func(chan chunk, lineFormat) simpleMap{
+		"default":   chunkReader,
+		"histogram": histogramChunkReader,
+	}
+	for reader, read := range readers {
+		chunks := make(chan chunk, 1)
+		chunks <- chunk{data: data.Bytes()}
+		close(chunks)
+		stationData := read(chunks, defaultLineFormat)
+		require.Equal(t, len(referenceStations), stationData.len())
+		for _, item := range stationData.Iter() {
+			assert.False(t, inside(item.name, data.Bytes()), "%s: %s", reader, item.name)
+		}
+	}
+}
+
+// BenchmarkRetainedMemory reports the heap which is still in use after
+// the aggregation, while only the stations are referenced. Without the
+// interned names it was every chunk which introduced a new station.
+func BenchmarkRetainedMemory(b *testing.B) {
+	var data bytes.Buffer
+	require.NoError(b, generate(&data, generateOptions{rows: 4_000_000, stations: 10_000, seed: 1}))
+	defer func(readers int) { chunkReaders = readers }(chunkReaders)
+	chunkReaders = 4
+
+	b.ReportAllocs()
+	for range b.N {
+		stationData, err := aggregate(bytes.NewReader(data.Bytes()), defaultOptions())
+		require.NoError(b, err)
+
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		b.ReportMetric(float64(m.HeapInuse-uint64(data.Cap()))/float64(MiB), "retained-MiB")
+		runtime.KeepAlive(stationData)
+	}
+}
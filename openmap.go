@@ -0,0 +1,136 @@
+package main
+
+import (
+	"iter"
+	"unsafe"
+)
+
+// openMap is flat open addressing map with linear probing. The stats are
+// stored inline in the slots and the names are copied into an arena, so
+// there is no pointer to chase per line and the whole map is 2 allocations
+// instead of a slice and stats per station. The position from pos is the
+// hash of the name, the probing starts at its low bits, so the name is
+// still hashed once.
+type openMap struct {
+	slots  []openSlot
+	mask   uint32
+	length int
+	// arena holds all the names back to back, the slots point into it.
+	arena []byte
+}
+
+type openSlot struct {
+	stats   stats
+	nameOff uint32
+	nameLen uint32
+	// hash is kept for grow and Iter, so the names are not hashed again.
+	hash uint32
+	used bool
+}
+
+// newOpenMap allocates power of two slots for at least twice
+// the stations, linear probing gets slow when it is over half full.
+func newOpenMap(stations int) *openMap {
+	capacity := 1
+	for capacity < 2*stations {
+		capacity <<= 1
+	}
+	return &openMap{
+		slots: make([]openSlot, capacity),
+		mask:  uint32(capacity - 1),
+		arena: make([]byte, 0, 16*stations),
+	}
+}
+
+func (m *openMap) name(slot *openSlot) stationName {
+	if slot.nameLen == 0 {
+		return ""
+	}
+	return stationName(unsafe.String(&m.arena[slot.nameOff], slot.nameLen))
+}
+
+// find returns the slot of the name, or the empty slot where it belongs.
+func (m *openMap) find(pos uint32, name stationName) (uint32, bool) {
+	for i := pos & m.mask; ; i = (i + 1) & m.mask {
+		slot := &m.slots[i]
+		if !slot.used {
+			return i, false
+		}
+		if int(slot.nameLen) == len(name) && m.name(slot) == name {
+			return i, true
+		}
+	}
+}
+
+// pos is the seeded stationHash of the name like in simpleMap, find
+// masks it to the slots, so it stays valid when the map grows.
+func (m *openMap) pos(name stationName) uint32 {
+	return stationHash(name)
+}
+
+func (m *openMap) get(pos uint32, name stationName) (*stats, bool) {
+	i, ok := m.find(pos, name)
+	if !ok {
+		return nil, false
+	}
+	return &m.slots[i].stats, true
+}
+
+// set copies the stats into the slot, later changes of st are not
+// seen by the map, get returns the pointer to the stored stats.
+func (m *openMap) set(pos uint32, name stationName, st *stats) {
+	i, ok := m.find(pos, name)
+	if ok {
+		m.slots[i].stats = *st
+		return
+	}
+	if 2*(m.length+1) > len(m.slots) {
+		m.grow()
+		i, _ = m.find(pos, name)
+	}
+	m.slots[i] = openSlot{
+		stats:   *st,
+		nameOff: uint32(len(m.arena)),
+		nameLen: uint32(len(name)),
+		hash:    pos,
+		used:    true,
+	}
+	m.arena = append(m.arena, name...)
+	m.length++
+}
+
+// grow doubles the slots, the names stay in the arena.
+func (m *openMap) grow() {
+	old := m.slots
+	m.slots = make([]openSlot, 2*len(old))
+	m.mask = uint32(len(m.slots) - 1)
+	for i := range old {
+		if !old[i].used {
+			continue
+		}
+		// The names are unique, so just the first empty slot.
+		j := old[i].hash & m.mask
+		for m.slots[j].used {
+			j = (j + 1) & m.mask
+		}
+		m.slots[j] = old[i]
+	}
+}
+
+func (m *openMap) len() int {
+	return m.length
+}
+
+func (m *openMap) Iter() iter.Seq2[uint32, bucketItem] {
+	return func(yield func(pos uint32, item bucketItem) bool) {
+		for i := range m.slots {
+			slot := &m.slots[i]
+			if !slot.used {
+				continue
+			}
+			if !yield(slot.hash, bucketItem{name: m.name(slot), stats: &slot.stats}) {
+				return
+			}
+		}
+	}
+}
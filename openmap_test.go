@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenMap(t *testing.T) {
+	m := newOpenMap(2)
+	require.Len(t, m.slots, 4)
+
+	// Grows from 4 slots while keeping all the stations.
+	for i := range 100 {
+		name := stationName(fmt.Sprintf("station %d", i))
+		pos := m.pos(name)
+		_, ok := m.get(pos, name)
+		require.False(t, ok, name)
+		m.set(pos, name, &stats{sum: sumT(i), count: 1})
+	}
+	assert.Equal(t, 100, m.len())
+	assert.Len(t, m.slots, 256)
+	for i := range 100 {
+		name := stationName(fmt.Sprintf("station %d", i))
+		st, ok := m.get(m.pos(name), name)
+		require.True(t, ok, name)
+		assert.Equal(t, stats{sum: sumT(i), count: 1}, *st)
+	}
+
+	var iterated int
+	for pos, item := range m.Iter() {
+		assert.Equal(t, m.pos(item.name), pos)
+		st, ok := m.get(pos, item.name)
+		require.True(t, ok)
+		assert.Same(t, item.stats, st)
+		iterated++
+	}
+	assert.Equal(t, 100, iterated)
+}
+
+func TestOpenMapSet(t *testing.T) {
+	m := newOpenMap(10)
+	st := &stats{count: 1}
+	m.set(m.pos("Hamburg"), "Hamburg", st)
+
+	// The stats are copied, the stored ones are updated in place.
+	st.count = 5
+	stored, ok := m.get(m.pos("Hamburg"), "Hamburg")
+	require.True(t, ok)
+	assert.Equal(t, countT(1), stored.count)
+	stored.count++
+	m.set(m.pos("Hamburg"), "Hamburg", &stats{count: 7})
+	stored, _ = m.get(m.pos("Hamburg"), "Hamburg")
+	assert.Equal(t, countT(7), stored.count)
+	assert.Equal(t, 1, m.len())
+
+	// Empty name from the generic parser is a valid key too.
+	m.set(m.pos(""), "", &stats{count: 2})
+	stored, ok = m.get(m.pos(""), "")
+	require.True(t, ok)
+	assert.Equal(t, countT(2), stored.count)
+	assert.Equal(t, 2, m.len())
+}
+
+// TestOpenMapCollisions fills one probe sequence with crafted names.
+func TestOpenMapCollisions(t *testing.T) {
+	stations, err := collisionStations(100, 3)
+	require.NoError(t, err)
+	m := newOpenMap(len(stations))
+	for i, station := range stations {
+		name := stationName(station.name)
+		m.set(m.pos(name), name, &stats{count: countT(i + 1)})
+	}
+	for i, station := range stations {
+		name := stationName(station.name)
+		st, ok := m.get(m.pos(name), name)
+		require.True(t, ok, name)
+		assert.Equal(t, countT(i+1), st.count)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// options holds everything configurable from the command line.
+// Defaults reproduce the original 1BRC behaviour.
+type options struct {
+	file string
+	// files are all the measurements files for the commands
+	// accepting more than one, file is then the first of them.
+	files  []string
+	format lineFormat
+	output outputFormat
+	window window
+	// histogram of each station is collected (for --format html).
+	histogram bool
+	// columns selected for the table and markdown outputs.
+	columns []string
+
+	// checkpoint file to resume from when the input file is appended.
+	checkpoint string
+
+	// follow the file for appended lines and write the output
+	// every snapshotInterval into snapshotOut (or stdout).
+	follow           bool
+	snapshotInterval time.Duration
+	snapshotOut      string
+
+	// sqlite database file to export the results to, with the
+	// pre-merge map of each worker when sqliteChunkStats is set.
+	sqlite           string
+	sqliteChunkStats bool
+
+	// mapBackend the aggregate workers collect the stats into.
+	mapBackend mapBackend
+	// maxMemory limits the chunk buffers, 0 is one per reader.
+	maxMemory int
+	// scheduler hands the chunks of the file to the workers.
+	scheduler scheduler
+	// input reads the file with ReadAt or maps it.
+	input inputBackend
+
+	// workerDone is called by each aggregate worker with its map
+	// before the maps are merged, nil when not needed.
+	workerDone func(worker int, stationData simpleMap)
+}
+
+func defaultOptions() options {
+	return options{
+		file:   defaultMeasurementsFile,
+		format: defaultLineFormat,
+		output: formatText,
+
+		mapBackend: mapBackendSimple,
+		scheduler:  schedulerProducer,
+		input:      inputRead,
+
+		snapshotInterval: 10 * time.Second,
+	}
+}
+
+// parseOptions parses the command line arguments (without the program name).
+// The measurements file is the only positional argument and is optional.
+func parseOptions(args []string, output io.Writer) (options, error) {
+	return parseCommandOptions("1brc", rootUsage, args, output, false, nil)
+}
+
+// parseCommandOptions is parseOptions for the subcommands, which can
+// register extra flags of their own with the extraFlags callback.
+func parseCommandOptions(name, usage string, args []string, output io.Writer, multipleFiles bool, extraFlags func(fs *flag.FlagSet)) (options, error) {
+	var (
+		opts       = defaultOptions()
+		delimiter  string
+		decimalSep string
+		formatName string
+		windowSize string
+		columns    string
+		backend    string
+		maxMemory  string
+		schedule   string
+		input      string
+		fs         = flag.NewFlagSet(name, flag.ContinueOnError)
+	)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "%s\nFlags:\n", usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&delimiter, "delimiter", opts.format.delimiter, "field separator between station name and measurement")
+	fs.StringVar(&decimalSep, "decimal-sep", opts.format.decimalSep, "decimal separator of the measurement")
+	fs.StringVar(&formatName, "format", string(opts.output), fmt.Sprintf("output format, one of: %v", outputFormats))
+	fs.StringVar(&columns, "columns", "", fmt.Sprintf("comma separated columns of --format table or markdown, any of: %s", strings.Join(tableColumnNames(), ",")))
+	fs.BoolVar(&opts.histogram, "histogram", false, "collect histogram of each station's measurements, shown by --format html")
+	fs.StringVar(&windowSize, "window", "", "aggregate per time window (e.g. 1h, 1d, 1mo), lines must be `station;timestamp;measurement`")
+	fs.StringVar(&opts.checkpoint, "checkpoint", "", "resume from this checkpoint file and update it, only appended data is read")
+	fs.BoolVar(&opts.follow, "follow", false, "keep reading lines appended to the file (like tail -F) and write periodic snapshots")
+	fs.DurationVar(&opts.snapshotInterval, "snapshot-interval", opts.snapshotInterval, "how often --follow writes the snapshot")
+	fs.StringVar(&opts.snapshotOut, "snapshot-out", "", "file --follow atomically replaces with each snapshot (default stdout)")
+	fs.StringVar(&opts.sqlite, "sqlite", "", "also export the results into this SQLite database file")
+	fs.StringVar(&backend, "map", string(opts.mapBackend), fmt.Sprintf("map backend of the workers, one of: %v", mapBackends))
+	fs.StringVar(&maxMemory, "max-memory", "", "limit of the chunk buffers (e.g. 512MiB), the reading waits for the workers when reached (default one chunk per worker)")
+	fs.StringVar(&schedule, "schedule", string(opts.scheduler), fmt.Sprintf("how the workers get the chunks, one of: %v", schedulers))
+	fs.StringVar(&input, "input", string(opts.input), fmt.Sprintf("how the file is read, one of: %v", inputBackends))
+	hashSeedFlag(fs)
+	fs.BoolVar(&opts.sqliteChunkStats, "sqlite-chunk-stats", false, "add chunk_stats table with the stats of each worker before merge to --sqlite")
+	if extraFlags != nil {
+		extraFlags(fs)
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return opts, usageError{err}
+	}
+
+	opts.files = fs.Args()
+	if len(opts.files) > 0 {
+		opts.file = opts.files[0]
+	}
+	if !multipleFiles && len(opts.files) > 1 {
+		return opts, fmt.Errorf("expected at most 1 measurements file, got: %d", len(opts.files))
+	}
+
+	opts.format, err = newLineFormat(unescape(delimiter), unescape(decimalSep))
+	if err != nil {
+		return opts, err
+	}
+	opts.output, err = parseOutputFormat(formatName)
+	if err != nil {
+		return opts, err
+	}
+	opts.mapBackend, err = parseMapBackend(backend)
+	if err != nil {
+		return opts, err
+	}
+	opts.window, err = parseWindow(windowSize)
+	if err != nil {
+		return opts, err
+	}
+	opts.scheduler, err = parseScheduler(schedule)
+	if err != nil {
+		return opts, err
+	}
+	opts.input, err = parseInputBackend(input)
+	if err != nil {
+		return opts, err
+	}
+	if opts.input == inputMmap && maxMemory != "" {
+		return opts, fmt.Errorf("%w: --max-memory limits the read buffers, --input mmap has none", errInvalidInput)
+	}
+	if opts.input == inputMmap && opts.follow {
+		// Truncating the mapped file would crash the process with SIGBUS.
+		return opts, fmt.Errorf("%w: --follow does not support --input mmap", errInvalidInput)
+	}
+	if maxMemory != "" {
+		opts.maxMemory, err = parseByteSize(maxMemory)
+		if err != nil {
+			return opts, err
+		}
+		_, err = chunkBuffers(opts.maxMemory, opts.scheduler)
+		if err != nil {
+			return opts, err
+		}
+	}
+	if opts.window.enabled() && !slices.Contains([]outputFormat{formatCSV, formatJSON, formatPrometheus, formatTable, formatMarkdown}, opts.output) {
+		return opts, fmt.Errorf("%w: --window requires --format csv, json, prometheus, table or markdown", errInvalidOutputFormat)
+	}
+	if columns != "" {
+		if opts.output != formatTable && opts.output != formatMarkdown {
+			return opts, fmt.Errorf("%w: --columns requires --format table or markdown", errInvalidColumns)
+		}
+		opts.columns, err = parseColumns(columns, opts.window)
+		if err != nil {
+			return opts, err
+		}
+	}
+	if opts.histogram && opts.window.enabled() {
+		return opts, fmt.Errorf("%w: --histogram does not support --window", errInvalidWindow)
+	}
+	if opts.mapBackend != mapBackendSimple && (opts.histogram || opts.window.enabled()) {
+		return opts, fmt.Errorf("%w: --map %s does not support --histogram or --window", errInvalidMapBackend, opts.mapBackend)
+	}
+	if opts.histogram && opts.checkpoint != "" {
+		return opts, errHistogramCheckpoint
+	}
+	if opts.follow && opts.checkpoint != "" {
+		return opts, errFollowCheckpoint
+	}
+	if opts.sqlite != "" && opts.window.enabled() {
+		return opts, errSQLiteWindow
+	}
+	if opts.sqlite != "" && opts.follow {
+		return opts, errSQLiteFollow
+	}
+	if opts.sqliteChunkStats && opts.sqlite == "" {
+		return opts, errSQLiteChunkStats
+	}
+	if opts.snapshotInterval <= 0 {
+		return opts, fmt.Errorf("--snapshot-interval must be positive, got: %s", opts.snapshotInterval)
+	}
+	return opts, nil
+}
+
+// hashSeedFlag registers --hash-seed. The seed is process wide, all the
+// maps have to agree on the positions, so it is set right when parsed.
+func hashSeedFlag(fs *flag.FlagSet) {
+	fs.Func("hash-seed", "seed of the station name hash (default random), set it for reproducible benchmarks", func(s string) error {
+		seed, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return err
+		}
+		hashSeed = uint32(seed)
+		return nil
+	})
+}
+
+// unescape allows passing `\t` on the command line, which
+// is much easier than typing a literal tab into the shell.
+func unescape(s string) string {
+	return strings.NewReplacer(`\t`, "\t", `\\`, `\`).Replace(s)
+}
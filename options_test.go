@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, err := parseOptions(nil, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, defaultOptions(), opts)
+
+	opts, err = parseOptions([]string{"--delimiter", `\t`, "--decimal-sep", ",", "file.tsv"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "file.tsv", opts.file)
+	assert.Equal(t, "\t", opts.format.delimiter)
+	assert.Equal(t, ",", opts.format.decimalSep)
+	assert.True(t, opts.format.fixedOffset())
+
+	_, err = parseOptions([]string{"--delimiter", ",", "--decimal-sep", ","}, io.Discard)
+	assert.ErrorIs(t, err, errInvalidLineFormat)
+
+	_, err = parseOptions([]string{"a.txt", "b.txt"}, io.Discard)
+	assert.Error(t, err)
+}
+
+func TestParseHashSeed(t *testing.T) {
+	defer func(seed uint32) { hashSeed = seed }(hashSeed)
+
+	_, err := parseOptions([]string{"--hash-seed", "42"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(42), hashSeed)
+
+	_, err = parseOptions([]string{"--hash-seed", "-1"}, io.Discard)
+	assert.Error(t, err)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type outputFormat string
+
+const (
+	// formatText is the original 1BRC `{name=min/mean/max, ...}`.
+	formatText outputFormat = "text"
+	formatCSV  outputFormat = "csv"
+	formatJSON outputFormat = "json"
+	// formatPrometheus is the text exposition format, e.g. for
+	// the node-exporter textfile collector.
+	formatPrometheus outputFormat = "prometheus"
+	// formatArrow and formatParquet are binary columnar formats.
+	formatArrow   outputFormat = "arrow"
+	formatParquet outputFormat = "parquet"
+	// formatTable and formatMarkdown are aligned columns for humans.
+	formatTable    outputFormat = "table"
+	formatMarkdown outputFormat = "markdown"
+	// formatHTML is a self-contained report with charts.
+	formatHTML outputFormat = "html"
+)
+
+var (
+	outputFormats = []outputFormat{formatText, formatCSV, formatJSON, formatPrometheus, formatArrow, formatParquet, formatTable, formatMarkdown, formatHTML}
+
+	errInvalidOutputFormat = errors.New("invalid output format")
+)
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	for _, f := range outputFormats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q, expected one of: %v", errInvalidOutputFormat, s, outputFormats)
+}
+
+// writeOutput writes the merged station data in the selected format.
+func writeOutput(writer io.Writer, sumStationData simpleMap, opts options) error {
+	switch opts.output {
+	case formatCSV:
+		return writeCSV(writer, sumStationData, opts.window)
+	case formatJSON:
+		return writeJSON(writer, sumStationData, opts.window)
+	case formatPrometheus:
+		return writePrometheus(writer, sumStationData, opts.window)
+	case formatTable:
+		return writeTable(writer, sumStationData, opts.window, opts.columns)
+	case formatMarkdown:
+		return writeMarkdown(writer, sumStationData, opts.window, opts.columns)
+	}
+
+	if opts.window.enabled() {
+		return fmt.Errorf("%w: %q does not support --window, use csv, json, prometheus, table or markdown", errInvalidOutputFormat, opts.output)
+	}
+	switch opts.output {
+	case formatArrow:
+		return writeArrow(writer, sumStationData)
+	case formatParquet:
+		return writeParquet(writer, sumStationData)
+	case formatHTML:
+		return writeHTML(writer, sumStationData)
+	default:
+		return printOutput(writer, sumStationData)
+	}
+}
+
+// outputRow is one line of the tabular outputs, windowStart
+// is only valid when the window is enabled.
+type outputRow struct {
+	name        stationName
+	windowStart int64
+	stats       *stats
+}
+
+// outputRows returns the rows sorted by station (and window start).
+func outputRows(sumStationData simpleMap, w window) []outputRow {
+	names := sortedStations(sumStationData)
+	rows := make([]outputRow, 0, len(names))
+	for _, station := range names {
+		stationStats, _ := sumStationData.get(station.pos, station.name)
+		row := outputRow{name: station.name, stats: stationStats}
+		if w.enabled() {
+			row.name, row.windowStart = splitWindowKey(station.name)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+func formatWindowStart(start int64) string {
+	return time.Unix(start, 0).UTC().Format(time.RFC3339)
+}
+
+func writeCSV(writer io.Writer, sumStationData simpleMap, w window) error {
+	csvWriter := csv.NewWriter(writer)
+	header := []string{"station", "min", "mean", "max", "count"}
+	if w.enabled() {
+		header = []string{"station", "window", "min", "mean", "max", "count"}
+	}
+	err := csvWriter.Write(header)
+	if err != nil {
+		return err
+	}
+
+	record := make([]string, 0, len(header))
+	for _, row := range outputRows(sumStationData, w) {
+		record = append(record[:0], string(row.name))
+		if w.enabled() {
+			record = append(record, formatWindowStart(row.windowStart))
+		}
+		record = append(record,
+			formatFloat(correctMagnitude(row.stats.min)),
+			formatFloat(mean(row.stats.sum, row.stats.count)),
+			formatFloat(correctMagnitude(row.stats.max)),
+			strconv.FormatUint(uint64(row.stats.count), 10),
+		)
+		err = csvWriter.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// jsonFloat keeps the 1 fractional digit, so 12.0 is not printed as 12.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	return []byte(formatFloat(float64(f))), nil
+}
+
+type jsonStats struct {
+	Window string    `json:"window,omitempty"`
+	Min    jsonFloat `json:"min"`
+	Mean   jsonFloat `json:"mean"`
+	Max    jsonFloat `json:"max"`
+	Count  countT    `json:"count"`
+}
+
+type jsonStation struct {
+	Station string `json:"station"`
+	*jsonStats
+	// Series is used instead of the embedded stats in window mode.
+	Series []jsonStats `json:"series,omitempty"`
+}
+
+func newJSONStats(st *stats) jsonStats {
+	return jsonStats{
+		Min:   jsonFloat(correctMagnitude(st.min)),
+		Mean:  jsonFloat(mean(st.sum, st.count)),
+		Max:   jsonFloat(correctMagnitude(st.max)),
+		Count: st.count,
+	}
+}
+
+// writeJSON writes array of stations sorted by name, in window mode
+// each station has a time series of the windows sorted by time.
+func writeJSON(writer io.Writer, sumStationData simpleMap, w window) error {
+	var stations []jsonStation
+	for _, row := range outputRows(sumStationData, w) {
+		st := newJSONStats(row.stats)
+		if !w.enabled() {
+			stations = append(stations, jsonStation{Station: string(row.name), jsonStats: &st})
+			continue
+		}
+		st.Window = formatWindowStart(row.windowStart)
+		// Rows are sorted by station, so the window belongs either to
+		// the last station or starts a new one.
+		if len(stations) == 0 || stations[len(stations)-1].Station != string(row.name) {
+			stations = append(stations, jsonStation{Station: string(row.name)})
+		}
+		last := &stations[len(stations)-1]
+		last.Series = append(last.Series, st)
+	}
+
+	buf := bufio.NewWriter(writer)
+	buf.WriteString("[")
+	for i, station := range stations {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  ")
+		b, err := json.Marshal(station)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	if len(stations) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+	return buf.Flush()
+}
+
+// prometheusMetrics are written as gauges with `station`
+// (and `window`) label for each station.
+var prometheusMetrics = []struct {
+	name, help string
+	value      func(st *stats) string
+}{
+	{
+		name:  "onebrc_station_temperature_min_celsius",
+		help:  "Minimum measured temperature of the station.",
+		value: func(st *stats) string { return formatFloat(correctMagnitude(st.min)) },
+	},
+	{
+		name:  "onebrc_station_temperature_mean_celsius",
+		help:  "Mean measured temperature of the station.",
+		value: func(st *stats) string { return formatFloat(mean(st.sum, st.count)) },
+	},
+	{
+		name:  "onebrc_station_temperature_max_celsius",
+		help:  "Maximum measured temperature of the station.",
+		value: func(st *stats) string { return formatFloat(correctMagnitude(st.max)) },
+	},
+	{
+		name:  "onebrc_station_measurements",
+		help:  "Number of measurements of the station.",
+		value: func(st *stats) string { return strconv.FormatUint(uint64(st.count), 10) },
+	},
+}
+
+// prometheusLabelEscaper escapes label values per the exposition format.
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writePrometheus(writer io.Writer, sumStationData simpleMap, w window) error {
+	var (
+		buf  = bufio.NewWriter(writer)
+		rows = outputRows(sumStationData, w)
+	)
+	// Labels are the same for all the metrics.
+	labels := make([]string, len(rows))
+	for i, row := range rows {
+		labels[i] = `station="` + prometheusLabelEscaper.Replace(string(row.name)) + `"`
+		if w.enabled() {
+			labels[i] += `,window="` + formatWindowStart(row.windowStart) + `"`
+		}
+	}
+
+	for _, metric := range prometheusMetrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", metric.name, metric.help, metric.name)
+		for i, row := range rows {
+			fmt.Fprintf(buf, "%s{%s} %s\n", metric.name, labels[i], metric.value(row.stats))
+		}
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOutput(t *testing.T) {
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+
+	var buf bytes.Buffer
+	err := writeOutput(&buf, stationData, defaultOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "{Bosaso=13.5/13.5/13.5, Bridgetown=9.3/9.3/9.3, Ho Chi Minh City=46.2/46.2/46.2, Jakarta=37.0/37.0/37.0, Ljubljana=-24.3/0.0/24.3, Nassau=22.7/22.7/22.7, Phnom Penh=27.0/27.0/27.0, Port Moresby=21.0/21.0/21.0, Tromsø=18.8/18.8/18.8, Ürümqi=-0.3/-0.3/-0.3}\n", buf.String())
+
+	buf.Reset()
+	err = writeOutput(&buf, stationData, options{output: formatCSV})
+	require.NoError(t, err)
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "station,min,mean,max,count", lines[0])
+	assert.Equal(t, "Bosaso,13.5,13.5,13.5,1", lines[1])
+	assert.Equal(t, "Ljubljana,-24.3,0.0,24.3,4", lines[5])
+
+	buf.Reset()
+	err = writeOutput(&buf, stationData, options{output: formatJSON})
+	require.NoError(t, err)
+	lines = strings.Split(buf.String(), "\n")
+	assert.Equal(t, "[", lines[0])
+	assert.Equal(t, `  {"station":"Bosaso","min":13.5,"mean":13.5,"max":13.5,"count":1},`, lines[1])
+	assert.Equal(t, `  {"station":"Ürümqi","min":-0.3,"mean":-0.3,"max":-0.3,"count":1}`, lines[10])
+	assert.Equal(t, "]", lines[11])
+}
+
+func TestWriteOutputWindow(t *testing.T) {
+	w := window{every: 24 * time.Hour}
+	stationData, err := windowChunkReader(chunkByBytes(bytes.NewReader(windowTestData), 64), defaultLineFormat, w)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = writeOutput(&buf, stationData, options{output: formatCSV, window: w})
+	require.NoError(t, err)
+	assert.Equal(t, `station,window,min,mean,max,count
+Bulawayo,1969-12-31T00:00:00Z,99.9,99.9,99.9,1
+Bulawayo,2024-01-01T00:00:00Z,8.9,8.9,8.9,1
+Hamburg,2024-01-01T00:00:00Z,-3.5,3.2,12.0,3
+Hamburg,2024-02-29T00:00:00Z,-99.9,-99.9,-99.9,1
+`, buf.String())
+
+	buf.Reset()
+	err = writeOutput(&buf, stationData, options{output: formatJSON, window: w})
+	require.NoError(t, err)
+	assert.Equal(t, `[
+  {"station":"Bulawayo","series":[{"window":"1969-12-31T00:00:00Z","min":99.9,"mean":99.9,"max":99.9,"count":1},{"window":"2024-01-01T00:00:00Z","min":8.9,"mean":8.9,"max":8.9,"count":1}]},
+  {"station":"Hamburg","series":[{"window":"2024-01-01T00:00:00Z","min":-3.5,"mean":3.2,"max":12.0,"count":3},{"window":"2024-02-29T00:00:00Z","min":-99.9,"mean":-99.9,"max":-99.9,"count":1}]}
+]
+`, buf.String())
+
+	err = writeOutput(&buf, stationData, options{output: formatText, window: w})
+	assert.ErrorIs(t, err, errInvalidOutputFormat)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	stationData := newSimpleMap(maxStations)
+	for _, name := range []stationName{`Portland "OR"`, `Back\slash`, "New\nline"} {
+		stationData.set(stationData.pos(name), name, &stats{min: -15, max: 305, sum: 290, count: 2})
+	}
+
+	var buf bytes.Buffer
+	err := writeOutput(&buf, stationData, options{output: formatPrometheus})
+	require.NoError(t, err)
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "# HELP onebrc_station_temperature_min_celsius Minimum measured temperature of the station.", lines[0])
+	assert.Equal(t, "# TYPE onebrc_station_temperature_min_celsius gauge", lines[1])
+	assert.Equal(t, `onebrc_station_temperature_min_celsius{station="Back\\slash"} -1.5`, lines[2])
+	assert.Equal(t, `onebrc_station_temperature_min_celsius{station="New\nline"} -1.5`, lines[3])
+	assert.Equal(t, `onebrc_station_temperature_min_celsius{station="Portland \"OR\""} -1.5`, lines[4])
+	assert.Equal(t, `onebrc_station_temperature_mean_celsius{station="Back\\slash"} 14.5`, lines[7])
+	assert.Equal(t, `onebrc_station_temperature_max_celsius{station="Back\\slash"} 30.5`, lines[12])
+	assert.Equal(t, `onebrc_station_measurements{station="Back\\slash"} 2`, lines[17])
+	assert.Len(t, lines, 4*(2+3)+1)
+}
+
+func TestWritePrometheusWindow(t *testing.T) {
+	w := window{months: 1}
+	stationData, err := windowChunkReader(chunkByBytes(bytes.NewReader(windowTestData), 64), defaultLineFormat, w)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = writeOutput(&buf, stationData, options{output: formatPrometheus, window: w})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `onebrc_station_measurements{station="Hamburg",window="2024-01-01T00:00:00Z"} 3`+"\n")
+	assert.Contains(t, buf.String(), `onebrc_station_measurements{station="Hamburg",window="2024-02-01T00:00:00Z"} 1`+"\n")
+}
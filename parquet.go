@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// writeParquet writes the output as Parquet file with single row group.
+func writeParquet(writer io.Writer, sumStationData simpleMap) error {
+	record := resultRecord(sumStationData)
+	defer record.Release()
+
+	// The writer closes the sink when it is io.Closer, it can be stdout.
+	sink := struct{ io.Writer }{writer}
+	w, err := pqarrow.NewFileWriter(resultSchema, sink, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps())
+	if err != nil {
+		return err
+	}
+	err = w.Write(record)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readParquet(t *testing.T, data []byte) *array.TableReader {
+	t.Helper()
+	pf, err := file.NewParquetReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.NewGoAllocator())
+	require.NoError(t, err)
+	table, err := reader.ReadTable(context.Background())
+	require.NoError(t, err)
+	return array.NewTableReader(table, -1)
+}
+
+func TestWriteParquet(t *testing.T) {
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, options{output: formatParquet}))
+
+	tableReader := readParquet(t, buf.Bytes())
+	defer tableReader.Release()
+	require.True(t, tableReader.Next())
+	assertResultRecord(t, tableReader.Record())
+}
+
+func TestWriteParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeParquet(&buf, newSimpleMap(10)))
+
+	tableReader := readParquet(t, buf.Bytes())
+	defer tableReader.Release()
+	assert.False(t, tableReader.Next())
+}
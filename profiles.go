@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// generateProfile is the layout of the generated data, standard is the
+// reference 1BRC distribution and the others are the edge cases the
+// parser, the chunking and the map must survive.
+type generateProfile struct {
+	name        string
+	description string
+	// defaultStations is used when the number of stations is not set.
+	defaultStations int
+	stations        func(n int, seed uint64) ([]weatherStation, error)
+	measurement     func(rng *rand.Rand, station weatherStation) measurement
+	// lineLen is the length of every line when it is fixed, the rows
+	// are rounded up so the file size is a multiple of the chunk size.
+	lineLen int
+	// hashSeeded names depend on the hashSeed, generate fixes it to
+	// profileHashSeed when --hash-seed is not set.
+	hashSeeded bool
+}
+
+// profileHashSeed is the hashSeed of the hashSeeded profiles without
+// --hash-seed, so the same --seed generates the same file.
+const profileHashSeed = 0
+
+// fixedLineNameLen makes the chunk-multiple lines `name;dd.d\n` 16 bytes,
+// which divides all the power of 2 (and 6MiB) chunk sizes.
+const fixedLineNameLen = 10
+
+var generateProfiles = []generateProfile{
+	{
+		name:            "standard",
+		description:     "reference stations with Gaussian temperatures around their means",
+		defaultStations: len(referenceStations),
+		stations:        generateStations,
+		measurement:     stationMeasurement,
+	},
+	{
+		name:            "long-names",
+		description:     "all names exactly 100 bytes",
+		defaultStations: len(referenceStations),
+		stations:        longNameStations,
+		measurement:     stationMeasurement,
+	},
+	{
+		name:            "short-names",
+		description:     "all names 1 byte, including digits and '-'",
+		defaultStations: len(shortNames),
+		stations:        shortNameStations,
+		measurement:     stationMeasurement,
+	},
+	{
+		name:            "utf8-boundary",
+		description:     "names only of multi-byte UTF-8, so chunk boundaries split the runes",
+		defaultStations: len(referenceStations),
+		stations:        utf8Stations,
+		measurement:     stationMeasurement,
+	},
+	{
+		name:            "one-station",
+		description:     "all rows of a single station",
+		defaultStations: 1,
+		stations:        oneStation,
+		measurement:     stationMeasurement,
+	},
+	{
+		name:            "collisions",
+		description:     "names all in the same simpleMap bucket with the same --hash-seed (default 0)",
+		defaultStations: 100,
+		stations:        collisionStations,
+		measurement:     stationMeasurement,
+		hashSeeded:      true,
+	},
+	{
+		name:            "extremes",
+		description:     "only -99.9 and 99.9",
+		defaultStations: len(referenceStations),
+		stations:        generateStations,
+		measurement:     extremeMeasurement,
+	},
+	{
+		name:            "chunk-multiple",
+		description:     "16 byte lines, the file size is an exact multiple of --chunk-size",
+		defaultStations: len(referenceStations),
+		stations:        fixedLenStations,
+		measurement:     fourByteMeasurement,
+		lineLen:         fixedLineNameLen + len(";dd.d\n"),
+	},
+}
+
+func lookupProfile(name string) (generateProfile, error) {
+	i := slices.IndexFunc(generateProfiles, func(p generateProfile) bool { return p.name == name })
+	if i == -1 {
+		names := make([]string, len(generateProfiles))
+		for i, profile := range generateProfiles {
+			names[i] = profile.name
+		}
+		return generateProfile{}, fmt.Errorf("%w: profile %q, expected one of: %s", errInvalidGenerateOptions, name, strings.Join(names, ", "))
+	}
+	return generateProfiles[i], nil
+}
+
+func checkStations(n, limit int) error {
+	if n < 1 || n > limit {
+		return fmt.Errorf("%w: stations must be between 1 and %d, got: %d", errInvalidGenerateOptions, limit, n)
+	}
+	return nil
+}
+
+func stationMeasurement(rng *rand.Rand, station weatherStation) measurement {
+	return gaussianMeasurement(rng, station.meanTemperature)
+}
+
+func extremeMeasurement(rng *rand.Rand, _ weatherStation) measurement {
+	if rng.IntN(2) == 0 {
+		return -999
+	}
+	return 999
+}
+
+// fourByteMeasurement is uniform over the values written in 4 bytes,
+// [-9.9,-0.1] and [10.0,99.9].
+func fourByteMeasurement(rng *rand.Rand, _ weatherStation) measurement {
+	m := measurement(rng.IntN(99 + 900))
+	if m < 99 {
+		return -(m + 1)
+	}
+	return m - 99 + 100
+}
+
+// longNameStations repeat a reference name up to 100 bytes, the
+// unique number is at the end so the names share long prefixes.
+func longNameStations(n int, seed uint64) ([]weatherStation, error) {
+	err := checkStations(n, len(referenceStations)*len(referenceStations))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rng      = rand.New(rand.NewPCG(seed, 0))
+		stations = make([]weatherStation, n)
+	)
+	for i := range stations {
+		base := referenceStations[rng.IntN(len(referenceStations))]
+		suffix := " " + strconv.Itoa(i)
+		name := truncateName(strings.Repeat(base.name+" ", maxStationNameLen/len(base.name)+1), maxStationNameLen-len(suffix))
+		// Truncating at the rune start can make it shorter.
+		name += strings.Repeat(".", maxStationNameLen-len(suffix)-len(name)) + suffix
+		stations[i] = weatherStation{name: name, meanTemperature: base.meanTemperature}
+	}
+	return stations, nil
+}
+
+// shortNames are all the printable ASCII bytes except the delimiter.
+var shortNames = func() []string {
+	var names []string
+	for b := byte(' '); b <= '~'; b++ {
+		if b != ';' {
+			names = append(names, string(b))
+		}
+	}
+	return names
+}()
+
+func shortNameStations(n int, seed uint64) ([]weatherStation, error) {
+	err := checkStations(n, len(shortNames))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rng      = rand.New(rand.NewPCG(seed, 0))
+		stations = make([]weatherStation, n)
+	)
+	for i, idx := range rng.Perm(len(shortNames))[:n] {
+		stations[i] = weatherStation{
+			name:            shortNames[idx],
+			meanTemperature: referenceStations[rng.IntN(len(referenceStations))].meanTemperature,
+		}
+	}
+	return stations, nil
+}
+
+// utf8Runes are 2, 3 and 4 byte runes, the wide and combining ones too.
+var utf8Runes = []rune("éüøçăşșñßžłđõ東京北海道大阪서울부산çǺฒ₂€🌡💧🏔𝔸𝔹")
+
+// utf8Stations are made only of multi-byte runes, so almost every
+// chunk boundary falls into the middle of a rune.
+func utf8Stations(n int, seed uint64) ([]weatherStation, error) {
+	err := checkStations(n, len(referenceStations)*len(referenceStations))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rng      = rand.New(rand.NewPCG(seed, 0))
+		stations = make([]weatherStation, 0, n)
+		seen     = make(map[string]bool, n)
+	)
+	for len(stations) < n {
+		var name strings.Builder
+		// Up to 25 runes of at most 4 bytes fit into 100 bytes.
+		for range 2 + rng.IntN(24) {
+			name.WriteRune(utf8Runes[rng.IntN(len(utf8Runes))])
+		}
+		if seen[name.String()] {
+			continue
+		}
+		seen[name.String()] = true
+		stations = append(stations, weatherStation{
+			name:            name.String(),
+			meanTemperature: referenceStations[rng.IntN(len(referenceStations))].meanTemperature,
+		})
+	}
+	return stations, nil
+}
+
+func oneStation(n int, seed uint64) ([]weatherStation, error) {
+	err := checkStations(n, 1)
+	if err != nil {
+		return nil, err
+	}
+	return generateStations(1, seed)
+}
+
+// collisionStations are reference names with a number searched so that
+// stationPos puts all of them into the same bucket of the default map,
+// they collide only with the same hashSeed.
+func collisionStations(n int, seed uint64) ([]weatherStation, error) {
+	err := checkStations(n, maxStations)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rng      = rand.New(rand.NewPCG(seed, 0))
+		stations = make([]weatherStation, 0, n)
+		target   = stationPos(stationName(referenceStations[rng.IntN(len(referenceStations))].name), maxStations)
+	)
+	for k := 0; len(stations) < n; k++ {
+		base := referenceStations[rng.IntN(len(referenceStations))]
+		// The number makes the names unique, each is tried once.
+		name := base.name + " " + strconv.Itoa(k)
+		if stationPos(stationName(name), maxStations) == target {
+			stations = append(stations, weatherStation{name: name, meanTemperature: base.meanTemperature})
+		}
+	}
+	return stations, nil
+}
+
+// fixedLenStations are 10 bytes long, a reference name prefix padded
+// with `_` and a unique number.
+func fixedLenStations(n int, seed uint64) ([]weatherStation, error) {
+	err := checkStations(n, 100_000)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rng      = rand.New(rand.NewPCG(seed, 0))
+		stations = make([]weatherStation, n)
+	)
+	for i := range stations {
+		base := referenceStations[rng.IntN(len(referenceStations))]
+		prefix := truncateName(base.name, fixedLineNameLen-5)
+		prefix += strings.Repeat("_", fixedLineNameLen-5-len(prefix))
+		stations[i] = weatherStation{name: fmt.Sprintf("%s%05d", prefix, i), meanTemperature: base.meanTemperature}
+	}
+	return stations, nil
+}
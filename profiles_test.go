@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerateProfiles aggregates every profile with several chunk sizes
+// and compares the output with the reference computed by the generator.
+func TestGenerateProfiles(t *testing.T) {
+	defer func(size int) { chunkSize = size }(chunkSize)
+	for _, profile := range generateProfiles {
+		t.Run(profile.name, func(t *testing.T) {
+			var (
+				dir       = t.TempDir()
+				input     = filepath.Join(dir, "measurements.txt")
+				expected  = filepath.Join(dir, "measurements.out")
+				reference bytes.Buffer
+				data      bytes.Buffer
+			)
+			require.NoError(t, generate(&data, generateOptions{
+				profile:   profile,
+				rows:      20_000,
+				seed:      3,
+				workers:   2,
+				chunkSize: 4 * kiB,
+				reference: &reference,
+			}))
+			require.NoError(t, defaultLineFormat.validate(data.Bytes()))
+			require.NoError(t, os.WriteFile(input, data.Bytes(), 0o644))
+			require.NoError(t, os.WriteFile(expected, reference.Bytes(), 0o644))
+
+			for _, size := range []int{4 * kiB, 4*kiB + 1, 127, 6 * MiB} {
+				chunkSize = size
+				opts := defaultOptions()
+				opts.file = input
+				assert.NoError(t, verify(opts, expected), "chunk size: %d", size)
+			}
+		})
+	}
+}
+
+// generatedStations returns the unique names and all the values of the file.
+func generatedStations(t *testing.T, profile string, rows int64) (map[string]bool, []string) {
+	t.Helper()
+	p, err := lookupProfile(profile)
+	require.NoError(t, err)
+	var data bytes.Buffer
+	require.NoError(t, generate(&data, generateOptions{profile: p, rows: rows, seed: 5, workers: 1, chunkSize: 4 * kiB}))
+
+	var (
+		names  = map[string]bool{}
+		values []string
+	)
+	for _, line := range strings.Split(strings.TrimSuffix(data.String(), "\n"), "\n") {
+		name, value, ok := strings.Cut(line, ";")
+		require.True(t, ok, line)
+		names[name] = true
+		values = append(values, value)
+	}
+	return names, values
+}
+
+func TestProfileStations(t *testing.T) {
+	names, _ := generatedStations(t, "long-names", 10_000)
+	assert.Len(t, names, len(referenceStations))
+	for name := range names {
+		assert.Len(t, name, maxStationNameLen)
+		assert.True(t, utf8.ValidString(name), name)
+	}
+
+	names, _ = generatedStations(t, "short-names", 10_000)
+	assert.Len(t, names, len(shortNames))
+	for name := range names {
+		assert.Len(t, name, 1)
+	}
+
+	names, _ = generatedStations(t, "utf8-boundary", 10_000)
+	for name := range names {
+		assert.True(t, utf8.ValidString(name), name)
+		assert.LessOrEqual(t, len(name), maxStationNameLen)
+		for _, r := range name {
+			assert.Greater(t, utf8.RuneLen(r), 1, name)
+		}
+	}
+
+	names, _ = generatedStations(t, "one-station", 1000)
+	assert.Len(t, names, 1)
+
+	names, _ = generatedStations(t, "collisions", 10_000)
+	assert.Len(t, names, 100)
+	var positions = map[uint32]bool{}
+	for name := range names {
+		positions[stationPos(stationName(name), maxStations)] = true
+	}
+	assert.Len(t, positions, 1)
+
+	_, values := generatedStations(t, "extremes", 1000)
+	for _, value := range values {
+		assert.Contains(t, []string{"-99.9", "99.9"}, value)
+	}
+}
+
+func TestProfileChunkMultiple(t *testing.T) {
+	profile, err := lookupProfile("chunk-multiple")
+	require.NoError(t, err)
+	for _, size := range []int{128, 4 * kiB, 6 * MiB} {
+		var data bytes.Buffer
+		require.NoError(t, generate(&data, generateOptions{profile: profile, rows: 1000, seed: 1, chunkSize: size}))
+		assert.NotZero(t, data.Len())
+		assert.Zero(t, data.Len()%size, "chunk size: %d", size)
+	}
+
+	var data bytes.Buffer
+	err = generate(&data, generateOptions{profile: profile, rows: 1000, seed: 1, chunkSize: 100})
+	assert.ErrorIs(t, err, errInvalidGenerateOptions)
+}
+
+func TestProfileStationsLimit(t *testing.T) {
+	for _, profile := range []string{"short-names", "one-station"} {
+		p, err := lookupProfile(profile)
+		require.NoError(t, err)
+		_, err = p.stations(1000, 1)
+		assert.ErrorIs(t, err, errInvalidGenerateOptions, profile)
+	}
+
+	_, err := lookupProfile("nope")
+	assert.ErrorIs(t, err, errInvalidGenerateOptions)
+}
+
+// TestGenerateHighCardinality runs the pipeline over more stations
+// than the maps start with, so every worker's map grows.
+func TestGenerateHighCardinality(t *testing.T) {
+	var (
+		dir       = t.TempDir()
+		input     = filepath.Join(dir, "measurements.txt")
+		expected  = filepath.Join(dir, "measurements.out")
+		reference bytes.Buffer
+		data      bytes.Buffer
+	)
+	require.NoError(t, generate(&data, generateOptions{rows: 200_000, stations: 5 * maxStations, seed: 4, reference: &reference}))
+	require.NoError(t, os.WriteFile(input, data.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(expected, reference.Bytes(), 0o644))
+
+	defer func(size int) { chunkSize = size }(chunkSize)
+	chunkSize = 64 * kiB
+	opts := defaultOptions()
+	opts.file = input
+	assert.NoError(t, verify(opts, expected))
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// peakRSS is not reported outside of unix.
+func peakRSS() int64 {
+	return 0
+}
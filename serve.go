@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// maxIngestBytes limits the body of a single POST /ingest.
+	maxIngestBytes int64 = 64 * int64(MiB)
+
+	errServeWindow = errors.New("serve does not support --window")
+)
+
+// server keeps the merged station data in memory and serves it as JSON.
+type server struct {
+	opts options
+
+	mu          sync.RWMutex
+	stationData simpleMap
+}
+
+// newServer aggregates all of opts.files with the same pipeline as run.
+func newServer(opts options) (*server, error) {
+	if opts.window.enabled() {
+		return nil, errServeWindow
+	}
+	s := &server{
+		opts:        opts,
+		stationData: newSimpleMap(maxStations),
+	}
+	for _, file := range opts.files {
+		fileOpts := opts
+		fileOpts.file = file
+		stationData, err := aggregateFile(fileOpts)
+		if err != nil {
+			return nil, err
+		}
+		sumChunk(&s.stationData, stationData)
+	}
+	return s, nil
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stations", s.handleStations)
+	mux.HandleFunc("GET /stations/{name}", s.handleStation)
+	mux.HandleFunc("GET /top", s.handleTop)
+	mux.HandleFunc("POST /ingest", s.handleIngest)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux
+}
+
+// stations returns copy of the stats of all the stations sorted by name,
+// so the handlers can work on them without holding the lock.
+func (s *server) stations() []jsonStation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows := outputRows(s.stationData, window{})
+	stations := make([]jsonStation, 0, len(rows))
+	for _, row := range rows {
+		st := newJSONStats(row.stats)
+		stations = append(stations, jsonStation{Station: string(row.name), jsonStats: &st})
+	}
+	return stations
+}
+
+// handleStations: GET /stations?prefix=Ab&mean_gte=10.5&mean_lte=20
+func (s *server) handleStations(w http.ResponseWriter, r *http.Request) {
+	var (
+		query  = r.URL.Query()
+		prefix = query.Get("prefix")
+	)
+	meanGTE, err := queryFloat(query.Get("mean_gte"), -1000)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	meanLTE, err := queryFloat(query.Get("mean_lte"), 1000)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	stations := s.stations()
+	filtered := stations[:0]
+	for _, station := range stations {
+		if !strings.HasPrefix(station.Station, prefix) {
+			continue
+		}
+		if float64(station.Mean) < meanGTE || float64(station.Mean) > meanLTE {
+			continue
+		}
+		filtered = append(filtered, station)
+	}
+	writeJSONResponse(w, http.StatusOK, filtered)
+}
+
+// handleStation: GET /stations/{name}
+func (s *server) handleStation(w http.ResponseWriter, r *http.Request) {
+	name := stationName(r.PathValue("name"))
+
+	s.mu.RLock()
+	stationStats, ok := s.stationData.get(s.stationData.pos(name), name)
+	var st jsonStats
+	if ok {
+		st = newJSONStats(stationStats)
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("station not found: %q", name))
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, jsonStation{Station: string(name), jsonStats: &st})
+}
+
+// handleTop: GET /top?by=mean&k=10&order=desc
+func (s *server) handleTop(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	by := query.Get("by")
+	if by == "" {
+		by = "mean"
+	}
+	key, ok := map[string]func(jsonStation) float64{
+		"min":   func(st jsonStation) float64 { return float64(st.Min) },
+		"mean":  func(st jsonStation) float64 { return float64(st.Mean) },
+		"max":   func(st jsonStation) float64 { return float64(st.Max) },
+		"count": func(st jsonStation) float64 { return float64(st.Count) },
+	}[by]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid by: %q, expected one of: min, mean, max, count", by))
+		return
+	}
+	k := 10
+	if query.Has("k") {
+		var err error
+		k, err = strconv.Atoi(query.Get("k"))
+		if err != nil || k < 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid k: %q", query.Get("k")))
+			return
+		}
+	}
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid order: %q, expected asc or desc", order))
+		return
+	}
+
+	stations := s.stations()
+	// Stable sort keeps the stations with equal value sorted by name.
+	sort.SliceStable(stations, func(i, j int) bool {
+		if order == "asc" {
+			return key(stations[i]) < key(stations[j])
+		}
+		return key(stations[i]) > key(stations[j])
+	})
+	writeJSONResponse(w, http.StatusOK, stations[:min(k, len(stations))])
+}
+
+// handleIngest: POST /ingest with lines in the measurements format,
+// which are merged into the served data.
+func (s *server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBytes))
+	if err != nil {
+		// Only the limit is 413, the rest is a broken request or client.
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	// The parsers trust the layout of the line, so untrusted
+	// input has to be validated first.
+	err = s.opts.format.validate(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	chunks := make(chan chunk, 1)
+	chunks <- chunk{data: data}
+	close(chunks)
+	ingested := chunkReader(chunks, s.opts.format)
+
+	s.mu.Lock()
+	sumChunk(&s.stationData, ingested)
+	stations := s.stationData.len()
+	s.mu.Unlock()
+
+	writeJSONResponse(w, http.StatusOK, map[string]int{
+		"lines":    bytes.Count(data, []byte{'\n'}),
+		"stations": stations,
+	})
+}
+
+// handleMetrics: GET /metrics in Prometheus text exposition format.
+// It is rendered under the lock and written after, so a slow scraper
+// doesn't block the ingest.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	s.mu.RLock()
+	err := writePrometheus(&buf, s.stationData, window{})
+	s.mu.RUnlock()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	// Error means the scraper went away, there is nobody to report it to.
+	_, _ = w.Write(buf.Bytes())
+}
+
+func queryFloat(value string, defaultValue float64) (float64, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %q", value)
+	}
+	return f, nil
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSONResponse(w, status, map[string]string{"error": err.Error()})
+}
+
+// serveCommand: 1brc serve [--addr :8080] [flags] [measurements.txt ...]
+func serveCommand(args []string, output io.Writer) error {
+	var addr string
+	opts, err := parseCommandOptions(
+		"serve",
+		"Usage: 1brc serve [flags] [measurements.txt ...]\n",
+		args,
+		output,
+		true,
+		func(fs *flag.FlagSet) {
+			fs.StringVar(&addr, "addr", ":8080", "address to listen on")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	s, err := newServer(opts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(output, "Serving %d stations on %s\n", s.stationData.len(), addr)
+	err = httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
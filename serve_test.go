@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	opts := defaultOptions()
+	for i, part := range [][]byte{testData[:74], testData[74:]} {
+		file := filepath.Join(dir, string(rune('a'+i))+".txt")
+		require.NoError(t, os.WriteFile(file, part, 0o644))
+		opts.files = append(opts.files, file)
+	}
+	s, err := newServer(opts)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func getJSON(t *testing.T, url string, wantStatus int, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, wantStatus, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+// apiStation is the decoded jsonStation.
+type apiStation struct {
+	Station string  `json:"station"`
+	Min     float64 `json:"min"`
+	Mean    float64 `json:"mean"`
+	Max     float64 `json:"max"`
+	Count   int     `json:"count"`
+}
+
+func TestServeStations(t *testing.T) {
+	ts := newTestServer(t)
+
+	var stations []apiStation
+	getJSON(t, ts.URL+"/stations", http.StatusOK, &stations)
+	require.Len(t, stations, 10)
+	assert.Equal(t, apiStation{Station: "Bosaso", Min: 13.5, Mean: 13.5, Max: 13.5, Count: 1}, stations[0])
+	assert.Equal(t, apiStation{Station: "Ljubljana", Min: -24.3, Mean: 0.0, Max: 24.3, Count: 4}, stations[4])
+
+	getJSON(t, ts.URL+"/stations?prefix=P", http.StatusOK, &stations)
+	require.Len(t, stations, 2)
+	assert.Equal(t, "Phnom Penh", stations[0].Station)
+	assert.Equal(t, "Port Moresby", stations[1].Station)
+
+	getJSON(t, ts.URL+"/stations?mean_gte=20&mean_lte=30", http.StatusOK, &stations)
+	require.Len(t, stations, 3)
+
+	var errResp map[string]string
+	getJSON(t, ts.URL+"/stations?mean_gte=warm", http.StatusBadRequest, &errResp)
+
+	var station apiStation
+	getJSON(t, ts.URL+"/stations/"+"Ho%20Chi%20Minh%20City", http.StatusOK, &station)
+	assert.Equal(t, apiStation{Station: "Ho Chi Minh City", Min: 46.2, Mean: 46.2, Max: 46.2, Count: 1}, station)
+
+	getJSON(t, ts.URL+"/stations/Prague", http.StatusNotFound, &errResp)
+	assert.Contains(t, errResp["error"], "Prague")
+}
+
+func TestServeTop(t *testing.T) {
+	ts := newTestServer(t)
+
+	var stations []apiStation
+	getJSON(t, ts.URL+"/top?by=max&k=2", http.StatusOK, &stations)
+	require.Len(t, stations, 2)
+	assert.Equal(t, "Ho Chi Minh City", stations[0].Station)
+	assert.Equal(t, "Jakarta", stations[1].Station)
+
+	getJSON(t, ts.URL+"/top?by=min&k=1&order=asc", http.StatusOK, &stations)
+	require.Len(t, stations, 1)
+	assert.Equal(t, "Ljubljana", stations[0].Station)
+
+	getJSON(t, ts.URL+"/top?k=100", http.StatusOK, &stations)
+	assert.Len(t, stations, 10)
+
+	var errResp map[string]string
+	getJSON(t, ts.URL+"/top?by=name", http.StatusBadRequest, &errResp)
+	getJSON(t, ts.URL+"/top?k=-1", http.StatusBadRequest, &errResp)
+}
+
+func TestServeIngest(t *testing.T) {
+	ts := newTestServer(t)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(ts.URL+"/ingest", "text/plain", strings.NewReader("Prague;-10.0\nBosaso;50.5"))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}()
+	}
+	wg.Wait()
+
+	var station apiStation
+	getJSON(t, ts.URL+"/stations/Prague", http.StatusOK, &station)
+	assert.Equal(t, apiStation{Station: "Prague", Min: -10.0, Mean: -10.0, Max: -10.0, Count: 10}, station)
+	getJSON(t, ts.URL+"/stations/Bosaso", http.StatusOK, &station)
+	assert.Equal(t, apiStation{Station: "Bosaso", Min: 13.5, Mean: 47.1, Max: 50.5, Count: 11}, station)
+
+	resp, err := http.Post(ts.URL+"/ingest", "text/plain", strings.NewReader("Prague;cold\n"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServeIngestErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	// The client went away in the middle of the body.
+	rec := httptest.NewRecorder()
+	ts.Config.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ingest", iotest.ErrReader(errors.New("connection reset"))))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	defer func(limit int64) { maxIngestBytes = limit }(maxIngestBytes)
+	maxIngestBytes = 8
+	rec = httptest.NewRecorder()
+	ts.Config.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader("Prague;-10.0\n")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+// blockingWriter blocks the first Write until released, like a slow scraper.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	writing, release chan struct{}
+	once             sync.Once
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.writing)
+		<-w.release
+	})
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestServeMetricsSlowScraper(t *testing.T) {
+	ts := newTestServer(t)
+	w := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.Config.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	}()
+	<-w.writing
+	// Released also when the ingest fails, the server can't close before.
+	release := sync.OnceFunc(func() { close(w.release) })
+	t.Cleanup(release)
+
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(ts.URL+"/ingest", "text/plain", strings.NewReader("Prague;-10.0\n"))
+	require.NoError(t, err, "ingest waits for the scraper")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	release()
+	<-done
+	assert.Contains(t, w.Body.String(), `onebrc_station_measurements{station="Ljubljana"} 4`+"\n")
+}
+
+func TestServeMetrics(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `onebrc_station_temperature_mean_celsius{station="Ljubljana"} 0.0`+"\n")
+	assert.Contains(t, string(body), `onebrc_station_measurements{station="Ljubljana"} 4`+"\n")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqliteStationsSQL   = "CREATE TABLE stations(station TEXT NOT NULL, min REAL NOT NULL, mean REAL NOT NULL, max REAL NOT NULL, count INTEGER NOT NULL)"
+	sqliteChunkStatsSQL = "CREATE TABLE chunk_stats(worker INTEGER NOT NULL, station TEXT NOT NULL, min REAL NOT NULL, mean REAL NOT NULL, max REAL NOT NULL, count INTEGER NOT NULL)"
+)
+
+var (
+	errSQLiteWindow     = errors.New("--sqlite does not support --window")
+	errSQLiteFollow     = errors.New("--sqlite can't be used with --follow")
+	errSQLiteChunkStats = errors.New("--sqlite-chunk-stats requires --sqlite")
+)
+
+// sqliteTable is a table with its rows in the order of the columns.
+type sqliteTable struct {
+	name string
+	sql  string
+	rows [][]any
+}
+
+// writeSQLite creates the tables in the database file and inserts
+// the rows in a single transaction, with the pure Go SQLite driver.
+func writeSQLite(file string, tables []sqliteTable) error {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range tables {
+		_, err = tx.Exec(table.sql)
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.name, err)
+		}
+		err = insertRows(tx, table)
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.name, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func insertRows(tx *sql.Tx, table sqliteTable) error {
+	if len(table.rows) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.rows[0])), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", table.name, placeholders))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range table.rows {
+		_, err = stmt.Exec(row...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stationsTable is the final stats sorted by station name.
+func stationsTable(sumStationData simpleMap) sqliteTable {
+	cols := newResultColumns(sumStationData)
+	table := sqliteTable{name: "stations", sql: sqliteStationsSQL}
+	for i, station := range cols.station {
+		table.rows = append(table.rows, []any{
+			station, cols.min[i], cols.mean[i], cols.max[i], int64(cols.count[i]),
+		})
+	}
+	return table
+}
+
+// chunkStatsCollector records the map of each worker before it is merged.
+type chunkStatsCollector struct {
+	mu   sync.Mutex
+	rows map[int][][]any
+}
+
+// collect is called by the worker with its own map, the merge reuses
+// one of the maps, so the stats have to be copied right away.
+func (c *chunkStatsCollector) collect(worker int, stationData simpleMap) {
+	var rows [][]any
+	for _, station := range sortedStations(stationData) {
+		st, _ := stationData.get(station.pos, station.name)
+		rows = append(rows, []any{
+			int64(worker),
+			string(station.name),
+			correctMagnitude(st.min),
+			mean(st.sum, st.count),
+			correctMagnitude(st.max),
+			int64(st.count),
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rows == nil {
+		c.rows = make(map[int][][]any)
+	}
+	c.rows[worker] = append(c.rows[worker], rows...)
+}
+
+// table is the chunk_stats table sorted by worker and station.
+func (c *chunkStatsCollector) table() sqliteTable {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	workers := make([]int, 0, len(c.rows))
+	for worker := range c.rows {
+		workers = append(workers, worker)
+	}
+	sort.Ints(workers)
+
+	table := sqliteTable{name: "chunk_stats", sql: sqliteChunkStatsSQL}
+	for _, worker := range workers {
+		table.rows = append(table.rows, c.rows[worker]...)
+	}
+	return table
+}
+
+// writeSQLiteFile atomically writes the database with the stations table
+// and the chunk_stats table when the collector is not nil. The driver
+// needs a file instead of io.Writer, so it is writeFileAtomic by hand.
+func writeSQLiteFile(file string, sumStationData simpleMap, chunkStats *chunkStatsCollector) error {
+	tables := []sqliteTable{stationsTable(sumStationData)}
+	if chunkStats != nil {
+		tables = append(tables, chunkStats.table())
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file readable only by the owner.
+	err = tmp.Chmod(0o644)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = writeSQLite(tmp.Name(), tables)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
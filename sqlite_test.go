@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openSQLite(t *testing.T, file string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", file)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	var integrity string
+	require.NoError(t, db.QueryRow("PRAGMA integrity_check").Scan(&integrity))
+	require.Equal(t, "ok", integrity)
+	return db
+}
+
+func TestWriteSQLiteFile(t *testing.T) {
+	defer func(size, readers int) { chunkSize, chunkReaders = size, readers }(chunkSize, chunkReaders)
+	chunkSize, chunkReaders = 32, 4
+
+	var (
+		file       = filepath.Join(t.TempDir(), "out.db")
+		chunkStats = &chunkStatsCollector{}
+		opts       = defaultOptions()
+	)
+	opts.workerDone = chunkStats.collect
+	stationData, err := aggregate(bytes.NewReader(testData), opts)
+	require.NoError(t, err)
+	require.NoError(t, writeSQLiteFile(file, stationData, chunkStats))
+
+	db := openSQLite(t, file)
+	rows, err := db.Query("SELECT station, min, mean, max, count FROM stations ORDER BY rowid")
+	require.NoError(t, err)
+	var got strings.Builder
+	for rows.Next() {
+		var (
+			station        string
+			min, mean, max float64
+			count          int64
+		)
+		require.NoError(t, rows.Scan(&station, &min, &mean, &max, &count))
+		fmt.Fprintf(&got, "%s=%.1f/%.1f/%.1f/%d\n", station, min, mean, max, count)
+	}
+	require.NoError(t, rows.Err())
+
+	var want strings.Builder
+	for _, row := range outputRows(stationData, window{}) {
+		fmt.Fprintf(&want, "%s=%.1f/%.1f/%.1f/%d\n",
+			row.name, correctMagnitude(row.stats.min), mean(row.stats.sum, row.stats.count), correctMagnitude(row.stats.max), row.stats.count)
+	}
+	assert.Equal(t, want.String(), got.String())
+
+	// Which worker gets which chunk is up to the scheduler,
+	// but together they add up to the merged stats.
+	var lines, mismatched int
+	require.NoError(t, db.QueryRow("SELECT SUM(count) FROM chunk_stats WHERE worker BETWEEN 0 AND 3").Scan(&lines))
+	assert.Equal(t, bytes.Count(testData, []byte{'\n'}), lines)
+	require.NoError(t, db.QueryRow(`
+		SELECT COUNT(*) FROM stations s
+		WHERE s.count != (SELECT SUM(c.count) FROM chunk_stats c WHERE c.station = s.station)
+		   OR s.min != (SELECT MIN(c.min) FROM chunk_stats c WHERE c.station = s.station)
+		   OR s.max != (SELECT MAX(c.max) FROM chunk_stats c WHERE c.station = s.station)
+	`).Scan(&mismatched))
+	assert.Zero(t, mismatched)
+}
+
+func TestWriteSQLiteLargeTable(t *testing.T) {
+	const numRows = 200_000
+	table := sqliteTable{name: "t", sql: "CREATE TABLE t(id INTEGER, name TEXT, value REAL)"}
+	for i := range numRows {
+		table.rows = append(table.rows, []any{int64(i), fmt.Sprintf("station-%d", i), float64(i) / 10})
+	}
+	empty := sqliteTable{name: "empty", sql: "CREATE TABLE empty(id INTEGER)"}
+
+	file := filepath.Join(t.TempDir(), "large.db")
+	require.NoError(t, writeSQLite(file, []sqliteTable{table, empty}))
+
+	db := openSQLite(t, file)
+	var (
+		count       int
+		sumID       int64
+		name        string
+		value       float64
+		emptyCount  int
+		lookupRowID = 123_457
+	)
+	require.NoError(t, db.QueryRow("SELECT COUNT(*), SUM(id) FROM t").Scan(&count, &sumID))
+	assert.Equal(t, numRows, count)
+	assert.Equal(t, int64(numRows*(numRows-1)/2), sumID)
+	require.NoError(t, db.QueryRow("SELECT name, value FROM t WHERE rowid = ?", lookupRowID).Scan(&name, &value))
+	assert.Equal(t, "station-123456", name)
+	assert.Equal(t, 12345.6, value)
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM empty").Scan(&emptyCount))
+	assert.Zero(t, emptyCount)
+}
+
+func TestParseOptionsSQLite(t *testing.T) {
+	var out bytes.Buffer
+	_, err := parseOptions([]string{"--sqlite-chunk-stats"}, &out)
+	assert.ErrorIs(t, err, errSQLiteChunkStats)
+	_, err = parseOptions([]string{"--sqlite", "out.db", "--format", "csv", "--window", "1h"}, &out)
+	assert.ErrorIs(t, err, errSQLiteWindow)
+	_, err = parseOptions([]string{"--sqlite", "out.db", "--follow"}, &out)
+	assert.ErrorIs(t, err, errSQLiteFollow)
+
+	opts, err := parseOptions([]string{"--sqlite", "out.db", "--sqlite-chunk-stats"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "out.db", opts.sqlite)
+	assert.True(t, opts.sqliteChunkStats)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+)
+
+// State file stores the merged simpleMap so the aggregation can be
+// split across machines and merged later with the same sumChunk
+// semantics. The layout is (integers are varints unless noted):
+//
+//	magic "1BRCSTAT", version byte
+//	window, length prefixed string (empty when not windowed)
+//	number of stations
+//	for each station sorted by name:
+//	  name (length prefixed), sum, min, max, count
+//	crc32 IEEE of everything above, 4 bytes little endian
+const (
+	stateMagic   = "1BRCSTAT"
+	stateVersion = 1
+)
+
+// stateMaxMeasurement bounds min and max, the measurements are
+// [-99.9,99.9] * 10.
+const stateMaxMeasurement = 999
+
+var errInvalidState = errors.New("invalid state")
+
+// appendState serializes the station data into buf.
+func appendState(buf []byte, stationData simpleMap, w window) []byte {
+	buf = append(buf, stateMagic...)
+	buf = append(buf, stateVersion)
+	buf = appendStateString(buf, w.String())
+
+	names := sortedStations(stationData)
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+	for _, station := range names {
+		stationStats, _ := stationData.get(station.pos, station.name)
+		buf = appendStateString(buf, string(station.name))
+		buf = binary.AppendVarint(buf, int64(stationStats.sum))
+		buf = binary.AppendVarint(buf, int64(stationStats.min))
+		buf = binary.AppendVarint(buf, int64(stationStats.max))
+		buf = binary.AppendUvarint(buf, uint64(stationStats.count))
+	}
+
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+func appendStateString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func writeStateFile(file string, stationData simpleMap, w window) error {
+	return os.WriteFile(file, appendState(nil, stationData, w), 0o644)
+}
+
+// stateDecoder reads the fields one by one, remembering the 1st error
+// so the caller checks only once at the end.
+type stateDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *stateDecoder) fail(what string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: truncated or corrupted %s", errInvalidState, what)
+	}
+	d.data = nil
+}
+
+func (d *stateDecoder) uvarint(what string) uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail(what)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *stateDecoder) varint(what string) int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail(what)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *stateDecoder) string(what string) string {
+	n := d.uvarint(what)
+	if n > uint64(len(d.data)) {
+		d.fail(what)
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+// readState is the inverse of appendState.
+func readState(data []byte) (simpleMap, window, error) {
+	header := len(stateMagic) + 1
+	if len(data) < header+4 || !bytes.Equal(data[:len(stateMagic)], []byte(stateMagic)) {
+		return simpleMap{}, window{}, fmt.Errorf("%w: not a state file", errInvalidState)
+	}
+	if version := data[len(stateMagic)]; version != stateVersion {
+		return simpleMap{}, window{}, fmt.Errorf("%w: unsupported version: %d", errInvalidState, version)
+	}
+	payload, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return simpleMap{}, window{}, fmt.Errorf("%w: checksum mismatch", errInvalidState)
+	}
+
+	d := stateDecoder{data: payload[header:]}
+	w, err := parseWindow(d.string("window"))
+	if err != nil {
+		return simpleMap{}, window{}, fmt.Errorf("%w: %w", errInvalidState, err)
+	}
+
+	var (
+		n           = d.uvarint("number of stations")
+		stationData = newSimpleMap(maxStations)
+	)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		var (
+			name  = stationName(d.string("station name"))
+			sum   = d.varint("sum")
+			lo    = d.varint("min")
+			hi    = d.varint("max")
+			count = d.uvarint("count")
+		)
+		if d.err != nil {
+			break
+		}
+		// Checked before the conversions, which would wrap silently.
+		if count == 0 || count > math.MaxUint32 || lo < -stateMaxMeasurement || hi > stateMaxMeasurement || lo > hi ||
+			sum < lo*int64(count) || sum > hi*int64(count) {
+			return simpleMap{}, window{}, fmt.Errorf("%w: station: %q has invalid stats: sum=%d min=%d max=%d count=%d",
+				errInvalidState, name, sum, lo, hi, count)
+		}
+		st := &stats{sum: sumT(sum), min: minT(lo), max: maxT(hi), count: countT(count)}
+		pos := stationData.pos(name)
+		if _, ok := stationData.get(pos, name); ok {
+			return simpleMap{}, window{}, fmt.Errorf("%w: duplicate station: %q", errInvalidState, name)
+		}
+		stationData.set(pos, name, st)
+	}
+	if d.err != nil {
+		return simpleMap{}, window{}, d.err
+	}
+	if len(d.data) != 0 {
+		return simpleMap{}, window{}, fmt.Errorf("%w: %d trailing bytes", errInvalidState, len(d.data))
+	}
+	return stationData, w, nil
+}
+
+func readStateFile(file string) (simpleMap, window, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return simpleMap{}, window{}, err
+	}
+	stationData, w, err := readState(data)
+	if err != nil {
+		return simpleMap{}, window{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return stationData, w, nil
+}
+
+// mergeStateFiles reads and merges the states with sumChunk, the
+// same way the chunk workers are merged in a single run.
+func mergeStateFiles(files []string) (simpleMap, window, error) {
+	var (
+		stationData simpleMap
+		w           window
+	)
+	for i, file := range files {
+		part, partWindow, err := readStateFile(file)
+		if err != nil {
+			return simpleMap{}, window{}, err
+		}
+		if i == 0 {
+			stationData, w = part, partWindow
+			continue
+		}
+		if partWindow != w {
+			return simpleMap{}, window{}, fmt.Errorf("%s: %w: window %q does not match %q", file, errInvalidState, partWindow, w)
+		}
+		sumChunk(&stationData, part)
+	}
+	return stationData, w, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateRoundtrip(t *testing.T) {
+	want := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+	w := window{every: time.Hour}
+
+	got, gotWindow, err := readState(appendState(nil, want, w))
+	require.NoError(t, err)
+	assert.Equal(t, w, gotWindow)
+	require.Equal(t, want.len(), got.len())
+	for pos, item := range want.Iter() {
+		gotStats, ok := got.get(pos, item.name)
+		require.True(t, ok, "key: %s is not present in output", item.name)
+		assert.Equal(t, *item.stats, *gotStats)
+	}
+}
+
+func TestStateInvalid(t *testing.T) {
+	stationData := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+	state := appendState(nil, stationData, window{})
+
+	_, _, err := readState([]byte("measurements"))
+	assert.ErrorIs(t, err, errInvalidState)
+
+	corrupted := bytes.Clone(state)
+	corrupted[20] ^= 0xff
+	_, _, err = readState(corrupted)
+	assert.ErrorIs(t, err, errInvalidState)
+	assert.ErrorContains(t, err, "checksum")
+
+	version := bytes.Clone(state)
+	version[len(stateMagic)] = stateVersion + 1
+	_, _, err = readState(version)
+	assert.ErrorContains(t, err, "unsupported version")
+
+	_, _, err = readState(state[:len(state)-10])
+	assert.ErrorIs(t, err, errInvalidState)
+}
+
+// TestStateOutOfRange encodes the stats which would wrap in the stats
+// types, with a valid checksum so only the range checks catch them.
+func TestStateOutOfRange(t *testing.T) {
+	encode := func(sum, lo, hi int64, count uint64) []byte {
+		buf := append([]byte(stateMagic), stateVersion)
+		buf = appendStateString(buf, "")
+		buf = binary.AppendUvarint(buf, 1)
+		buf = appendStateString(buf, "Hamburg")
+		buf = binary.AppendVarint(buf, sum)
+		buf = binary.AppendVarint(buf, lo)
+		buf = binary.AppendVarint(buf, hi)
+		buf = binary.AppendUvarint(buf, count)
+		return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	}
+
+	stationData, _, err := readState(encode(20, -999, 999, 2))
+	require.NoError(t, err)
+	st, ok := stationData.get(stationData.pos("Hamburg"), "Hamburg")
+	require.True(t, ok)
+	assert.Equal(t, stats{sum: 20, min: -999, max: 999, count: 2}, *st)
+
+	for name, state := range map[string][]byte{
+		"min wraps int16": encode(0, -1<<16, 10, 1),
+		"max over 99.9":   encode(1000, 1000, 1000, 1),
+		"count wraps":     encode(10, 10, 10, 1<<32+1),
+		"sum over max":    encode(30, 10, 10, 2),
+		"sum under min":   encode(-30, -10, -10, 2),
+		"min over max":    encode(0, 10, -10, 1),
+		"no measurements": encode(0, 0, 0, 0),
+	} {
+		_, _, err := readState(state)
+		assert.ErrorIs(t, err, errInvalidState, name)
+		assert.ErrorContains(t, err, "invalid stats", name)
+	}
+}
+
+func TestMergeStateFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Split the data on line boundary into 2 parts, like on 2 machines.
+	parts := [][]byte{testData[:74], testData[74:]}
+	var files []string
+	for i, part := range parts {
+		file := dir + "/" + string(rune('a'+i)) + ".state"
+		stationData := chunkReader(chunkByBytes(bytes.NewReader(part), 32), defaultLineFormat)
+		require.NoError(t, writeStateFile(file, stationData, window{}))
+		files = append(files, file)
+	}
+
+	got, _, err := mergeStateFiles(files)
+	require.NoError(t, err)
+
+	var wantOutput, gotOutput bytes.Buffer
+	want := chunkReader(chunkByBytes(bytes.NewReader(testData), 32), defaultLineFormat)
+	require.NoError(t, printOutput(&wantOutput, want))
+	require.NoError(t, printOutput(&gotOutput, got))
+	assert.Equal(t, wantOutput.String(), gotOutput.String())
+	assert.Equal(t, want.len(), got.len())
+
+	windowed := dir + "/windowed.state"
+	require.NoError(t, writeStateFile(windowed, want, window{every: time.Hour}))
+	_, _, err = mergeStateFiles(append(files, windowed))
+	assert.ErrorIs(t, err, errInvalidState)
+}
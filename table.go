@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var errInvalidColumns = errors.New("invalid columns")
+
+// tableColumn is a column of the table and markdown outputs,
+// numeric columns are aligned to the right.
+type tableColumn struct {
+	name    string
+	numeric bool
+	value   func(row outputRow) string
+}
+
+var tableColumns = []tableColumn{
+	{name: "station", value: func(row outputRow) string { return string(row.name) }},
+	{name: "window", value: func(row outputRow) string { return formatWindowStart(row.windowStart) }},
+	{name: "min", numeric: true, value: func(row outputRow) string { return formatFloat(correctMagnitude(row.stats.min)) }},
+	{name: "mean", numeric: true, value: func(row outputRow) string { return formatFloat(mean(row.stats.sum, row.stats.count)) }},
+	{name: "max", numeric: true, value: func(row outputRow) string { return formatFloat(correctMagnitude(row.stats.max)) }},
+	{name: "count", numeric: true, value: func(row outputRow) string { return strconv.FormatUint(uint64(row.stats.count), 10) }},
+}
+
+func tableColumnNames() []string {
+	names := make([]string, len(tableColumns))
+	for i, column := range tableColumns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// parseColumns parses comma separated column names, empty
+// selects all the columns (window only in window mode).
+func parseColumns(s string, w window) ([]string, error) {
+	if s == "" {
+		var columns []string
+		for _, name := range tableColumnNames() {
+			if name != "window" || w.enabled() {
+				columns = append(columns, name)
+			}
+		}
+		return columns, nil
+	}
+
+	columns := strings.Split(s, ",")
+	for i, name := range columns {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(tableColumnNames(), name) {
+			return nil, fmt.Errorf("%w: %q, expected any of: %s", errInvalidColumns, name, strings.Join(tableColumnNames(), ","))
+		}
+		if name == "window" && !w.enabled() {
+			return nil, fmt.Errorf("%w: window column requires --window", errInvalidColumns)
+		}
+		if slices.Contains(columns[:i], name) {
+			return nil, fmt.Errorf("%w: duplicate column %q", errInvalidColumns, name)
+		}
+		columns[i] = name
+	}
+	return columns, nil
+}
+
+// tableCells formats the selected columns of all the rows,
+// no names select the default columns.
+func tableCells(sumStationData simpleMap, w window, names []string) ([]string, []tableColumn, [][]string) {
+	if len(names) == 0 {
+		names, _ = parseColumns("", w)
+	}
+	columns := make([]tableColumn, len(names))
+	for i, name := range names {
+		columns[i] = tableColumns[slices.Index(tableColumnNames(), name)]
+	}
+
+	rows := outputRows(sumStationData, w)
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(columns))
+		for j, column := range columns {
+			cells[i][j] = column.value(row)
+		}
+	}
+	return names, columns, cells
+}
+
+// columnWidths returns display width of the widest cell of each column.
+func columnWidths(header []string, cells [][]string) []int {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = displayWidth(h)
+	}
+	for _, row := range cells {
+		for i, cell := range row {
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+	return widths
+}
+
+// pad pads the cell with spaces up to the display width.
+func pad(cell string, width int, right bool) string {
+	padding := strings.Repeat(" ", max(0, width-displayWidth(cell)))
+	if right {
+		return padding + cell
+	}
+	return cell + padding
+}
+
+// writeTable writes aligned columns for reading in the terminal.
+func writeTable(writer io.Writer, sumStationData simpleMap, w window, names []string) error {
+	buf := bufio.NewWriter(writer)
+	names, columns, cells := tableCells(sumStationData, w, names)
+	widths := columnWidths(names, cells)
+	writeRow := func(row []string) {
+		var line strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			line.WriteString(pad(cell, widths[i], columns[i].numeric))
+		}
+		buf.WriteString(strings.TrimRight(line.String(), " "))
+		buf.WriteByte('\n')
+	}
+
+	writeRow(names)
+	rule := make([]string, len(widths))
+	for i, width := range widths {
+		rule[i] = strings.Repeat("-", width)
+	}
+	writeRow(rule)
+	for _, row := range cells {
+		writeRow(row)
+	}
+	return buf.Flush()
+}
+
+// markdownEscaper escapes the characters which would break the table.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ")
+
+// writeMarkdown writes GitHub flavored markdown table,
+// padded so it is readable also as plain text.
+func writeMarkdown(writer io.Writer, sumStationData simpleMap, w window, names []string) error {
+	buf := bufio.NewWriter(writer)
+	names, columns, cells := tableCells(sumStationData, w, names)
+	for _, row := range cells {
+		for i, cell := range row {
+			row[i] = markdownEscaper.Replace(cell)
+		}
+	}
+	widths := columnWidths(names, cells)
+	writeRow := func(row []string) {
+		buf.WriteString("|")
+		for i, cell := range row {
+			buf.WriteString(" " + pad(cell, widths[i], columns[i].numeric) + " |")
+		}
+		buf.WriteByte('\n')
+	}
+
+	writeRow(names)
+	buf.WriteString("|")
+	for i, column := range columns {
+		// Alignment row needs at least 3 characters.
+		width := max(widths[i], 3)
+		if column.numeric {
+			buf.WriteString(" " + strings.Repeat("-", width-1) + ": |")
+		} else {
+			buf.WriteString(" " + strings.Repeat("-", width) + " |")
+		}
+	}
+	buf.WriteByte('\n')
+	for _, row := range cells {
+		writeRow(row)
+	}
+	return buf.Flush()
+}
+
+// wideRanges are the East Asian Wide and Fullwidth blocks (and emoji)
+// taking 2 cells in the terminal, the common subset of the Unicode
+// EastAsianWidth.txt is good enough for padding station names.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},   // Hangul Jamo
+	{0x2e80, 0x303e},   // CJK Radicals .. CJK Symbols and Punctuation
+	{0x3041, 0x33ff},   // Hiragana .. CJK Compatibility
+	{0x3400, 0x4dbf},   // CJK Unified Ideographs Extension A
+	{0x4e00, 0x9fff},   // CJK Unified Ideographs
+	{0xa000, 0xa4cf},   // Yi
+	{0xac00, 0xd7a3},   // Hangul Syllables
+	{0xf900, 0xfaff},   // CJK Compatibility Ideographs
+	{0xfe30, 0xfe4f},   // CJK Compatibility Forms
+	{0xff00, 0xff60},   // Fullwidth Forms
+	{0xffe0, 0xffe6},   // Fullwidth Signs
+	{0x1f300, 0x1f64f}, // Misc Symbols and Pictographs, Emoticons
+	{0x1f900, 0x1f9ff}, // Supplemental Symbols and Pictographs
+	{0x20000, 0x3fffd}, // CJK Unified Ideographs Extension B ..
+}
+
+// runeWidth returns number of terminal cells the rune takes, combining
+// marks (e.g. decomposed `ș` in Chișinău) and format characters take none.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if r < wide[0] {
+			break
+		}
+		if r <= wide[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+func displayWidth(s string) int {
+	var width int
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
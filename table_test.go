@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	assert.Equal(t, 8, displayWidth("Chișinău"))
+	// Decomposed ș and ă are combining marks.
+	assert.Equal(t, 8, displayWidth("Chișinău"))
+	assert.Equal(t, 6, displayWidth("Ürümqi"))
+	assert.Equal(t, 4, displayWidth("東京"))
+	assert.Equal(t, 7, displayWidth("서울 ab"))
+}
+
+func TestWriteTable(t *testing.T) {
+	stationData := chunkReader(chunkByBytes(bytes.NewReader([]byte("Chișinău;12.3\n東京;-5.0\nAb;1.0\nChișinău;14.1\n")), 32), defaultLineFormat)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, options{output: formatTable}))
+	assert.Equal(t, `station    min  mean   max  count
+--------  ----  ----  ----  -----
+Ab         1.0   1.0   1.0      1
+Chișinău  12.3  13.2  14.1      2
+東京      -5.0  -5.0  -5.0      1
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeOutput(&buf, stationData, options{output: formatTable, columns: []string{"count", "station"}}))
+	assert.Equal(t, `count  station
+-----  --------
+    1  Ab
+    2  Chișinău
+    1  東京
+`, buf.String())
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	stationData := chunkReader(chunkByBytes(bytes.NewReader([]byte("Ürümqi;12.3\nA|b;-5.0\n")), 32), defaultLineFormat)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, options{output: formatMarkdown, columns: []string{"station", "mean"}}))
+	assert.Equal(t, `| station | mean |
+| ------- | ---: |
+| A\|b    | -5.0 |
+| Ürümqi  | 12.3 |
+`, buf.String())
+}
+
+func TestWriteTableWindow(t *testing.T) {
+	w := window{every: 24 * time.Hour}
+	stationData, err := windowChunkReader(chunkByBytes(bytes.NewReader(windowTestData), 64), defaultLineFormat, w)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, stationData, options{output: formatTable, window: w, columns: []string{"station", "window", "max"}}))
+	assert.Equal(t, `station   window                  max
+--------  --------------------  -----
+Bulawayo  1969-12-31T00:00:00Z   99.9
+Bulawayo  2024-01-01T00:00:00Z    8.9
+Hamburg   2024-01-01T00:00:00Z   12.0
+Hamburg   2024-02-29T00:00:00Z  -99.9
+`, buf.String())
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := parseColumns("", window{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"station", "min", "mean", "max", "count"}, columns)
+
+	columns, err = parseColumns("", window{every: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"station", "window", "min", "mean", "max", "count"}, columns)
+
+	columns, err = parseColumns("station, max", window{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"station", "max"}, columns)
+
+	for _, invalid := range []string{"median", "station,station", "window", ","} {
+		_, err = parseColumns(invalid, window{})
+		assert.ErrorIs(t, err, errInvalidColumns, invalid)
+	}
+
+	var out bytes.Buffer
+	_, err = parseOptions([]string{"--columns", "station"}, &out)
+	assert.ErrorIs(t, err, errInvalidColumns)
+	opts, err := parseOptions([]string{"--format", "markdown", "--columns", "station,count"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"station", "count"}, opts.columns)
+}
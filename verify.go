@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errVerifyMismatch = errors.New("output does not match")
+
+// verify runs the whole pipeline over opts.file and compares
+// the output byte-for-byte with the expected file.
+func verify(opts options, expectedFile string) error {
+	expected, err := os.ReadFile(expectedFile)
+	if err != nil {
+		return err
+	}
+	var got bytes.Buffer
+	err = runOutput(opts, &got)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(got.Bytes(), expected) {
+		return nil
+	}
+	return fmt.Errorf("%w %s: %s", errVerifyMismatch, expectedFile, firstDifference(got.Bytes(), expected))
+}
+
+// firstDifference describes where the outputs start to differ,
+// with a bit of context because the text output is a single line.
+func firstDifference(got, expected []byte) string {
+	const context = 40
+	i := 0
+	for i < len(got) && i < len(expected) && got[i] == expected[i] {
+		i++
+	}
+	excerpt := func(b []byte) []byte {
+		return b[max(0, i-context):min(len(b), i+context)]
+	}
+	return fmt.Sprintf("first difference at byte %d (got %d bytes, expected %d)\n  got:      %q\n  expected: %q",
+		i, len(got), len(expected), excerpt(got), excerpt(expected))
+}
+
+// verifyCommand: 1brc verify [flags] input.txt expected.out
+func verifyCommand(args []string, stdout, output io.Writer) error {
+	opts, err := parseCommandOptions(
+		"verify",
+		"Usage: 1brc verify [flags] measurements.txt expected.out\n",
+		args,
+		output,
+		true,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	if len(opts.files) != 2 {
+		return fmt.Errorf("verify: expected measurements and expected output files, got %d files", len(opts.files))
+	}
+	if opts.follow {
+		return errors.New("verify: --follow is not supported")
+	}
+
+	err = verify(opts, opts.files[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s: OK\n", opts.files[1])
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// samplesDir has the upstream .out files, their inputs are not in
+	// the repo, a sample is tested only when its .txt is added.
+	samplesDir = "test/resources/samples"
+	// syntheticDir has inputs made up to produce the upstream outputs,
+	// with the means on the rounding ties where the stations allow it.
+	syntheticDir = "test/resources/synthetic"
+)
+
+// goldenPairs returns the expected .out files which have the .txt input.
+func goldenPairs(t *testing.T) []string {
+	t.Helper()
+	var pairs []string
+	for _, dir := range []string{samplesDir, syntheticDir} {
+		expectedFiles, err := filepath.Glob(filepath.Join(dir, "*.out"))
+		require.NoError(t, err)
+		for _, expectedFile := range expectedFiles {
+			_, err := os.Stat(strings.TrimSuffix(expectedFile, ".out") + ".txt")
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			require.NoError(t, err)
+			pairs = append(pairs, expectedFile)
+		}
+	}
+	return pairs
+}
+
+// javaRound is Java's Math.round, ties are rounded towards positive infinity.
+func javaRound(x float64) float64 {
+	r := math.Floor(x)
+	if x-r >= 0.5 {
+		r++
+	}
+	return r
+}
+
+// javaBaseline transcribes CalculateAverage_baseline of the upstream
+// 1BRC, which produced the .out files: double sum of the parsed values,
+// mean = (Math.round(sum*10)/10.0)/count, every value printed by
+// Double.toString(Math.round(value*10)/10.0), the stations sorted by
+// TreeMap (UTF-16 code units).
+func javaBaseline(t *testing.T, data []byte) string {
+	t.Helper()
+	type aggregator struct {
+		min, max, sum float64
+		count         int
+	}
+	stations := map[string]*aggregator{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		name, value, ok := strings.Cut(line, ";")
+		require.True(t, ok, line)
+		v, err := strconv.ParseFloat(value, 64)
+		require.NoError(t, err, line)
+		a, ok := stations[name]
+		if !ok {
+			a = &aggregator{min: math.Inf(1), max: math.Inf(-1)}
+			stations[name] = a
+		}
+		a.min, a.max = math.Min(a.min, v), math.Max(a.max, v)
+		a.sum += v
+		a.count++
+	}
+
+	names := make([]string, 0, len(stations))
+	for name := range stations {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return slices.Compare(utf16.Encode([]rune(a)), utf16.Encode([]rune(b)))
+	})
+	round := func(v float64) string {
+		s := strconv.FormatFloat(javaRound(v*10.0)/10.0, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	entries := make([]string, len(names))
+	for i, name := range names {
+		a := stations[name]
+		mean := (javaRound(a.sum*10.0) / 10.0) / float64(a.count)
+		entries[i] = fmt.Sprintf("%s=%s/%s/%s", name, round(a.min), round(mean), round(a.max))
+	}
+	return "{" + strings.Join(entries, ", ") + "}\n"
+}
+
+// TestGoldenSamples runs the whole pipeline over every sample pair,
+// also with small chunks so the lines are split across the chunks.
+func TestGoldenSamples(t *testing.T) {
+	expectedFiles := goldenPairs(t)
+	require.NotEmpty(t, expectedFiles)
+
+	defer func(size int) { chunkSize = size }(chunkSize)
+	for _, size := range []int{chunkSize, 4 * kiB, 128} {
+		chunkSize = size
+		for _, expectedFile := range expectedFiles {
+			input := strings.TrimSuffix(expectedFile, ".out") + ".txt"
+			opts := defaultOptions()
+			opts.file = input
+			assert.NoError(t, verify(opts, expectedFile), "chunk size: %d", size)
+		}
+	}
+
+	// The inputs have to give the same output with the reference rounding.
+	for _, expectedFile := range expectedFiles {
+		input, err := os.ReadFile(strings.TrimSuffix(expectedFile, ".out") + ".txt")
+		require.NoError(t, err)
+		expected, err := os.ReadFile(expectedFile)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), javaBaseline(t, input), expectedFile)
+	}
+}
+
+// TestSyntheticOutputs keeps the synthetic .out files the same as the
+// upstream ones they were made for.
+func TestSyntheticOutputs(t *testing.T) {
+	upstreamFiles, err := filepath.Glob(filepath.Join(samplesDir, "measurements-*.out"))
+	require.NoError(t, err)
+	require.NotEmpty(t, upstreamFiles)
+	for _, upstreamFile := range upstreamFiles {
+		name := strings.TrimPrefix(filepath.Base(upstreamFile), "measurements-")
+		upstream, err := os.ReadFile(upstreamFile)
+		require.NoError(t, err)
+		synthetic, err := os.ReadFile(filepath.Join(syntheticDir, "synthetic-"+name))
+		require.NoError(t, err)
+		assert.Equal(t, string(upstream), string(synthetic), name)
+	}
+}
+
+func TestVerifyCommand(t *testing.T) {
+	var (
+		input    = filepath.Join(syntheticDir, "synthetic-3.txt")
+		expected = filepath.Join(syntheticDir, "synthetic-3.out")
+		stdout   bytes.Buffer
+	)
+	require.NoError(t, verifyCommand([]string{input, expected}, &stdout, io.Discard))
+	assert.Equal(t, expected+": OK\n", stdout.String())
+
+	wrong := filepath.Join(t.TempDir(), "wrong.out")
+	require.NoError(t, os.WriteFile(wrong, []byte("{Bosaso=-15.0/1.3/20.0, Petropavlovsk-Kamchatsky=-9.5/0.1/9.5}\n"), 0o644))
+	err := verifyCommand([]string{input, wrong}, io.Discard, io.Discard)
+	assert.ErrorIs(t, err, errVerifyMismatch)
+	assert.ErrorContains(t, err, "first difference at byte 56")
+
+	assert.Error(t, verifyCommand([]string{input}, io.Discard, io.Discard))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// window is the size of time bucket used when the records
+// carry a timestamp: `<station>;<timestamp>;<measurement>\n`.
+// Either fixed duration (hours, days) or calendar months,
+// all buckets are aligned to UTC.
+type window struct {
+	every  time.Duration
+	months int
+}
+
+var errInvalidWindow = errors.New("invalid window")
+
+func (w window) enabled() bool {
+	return w.every > 0 || w.months > 0
+}
+
+func (w window) String() string {
+	switch {
+	case w.months > 0:
+		return fmt.Sprintf("%dmo", w.months)
+	case w.every > 0 && w.every%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", w.every/(24*time.Hour))
+	case w.every > 0:
+		return w.every.String()
+	}
+	return ""
+}
+
+// parseWindow accepts Go durations (`15m`, `1h`) and also
+// days (`1d`) and calendar months (`1mo`) which
+// time.ParseDuration does not support.
+func parseWindow(s string) (window, error) {
+	if s == "" {
+		return window{}, nil
+	}
+	if n, ok := strings.CutSuffix(s, "mo"); ok {
+		months, err := strconv.Atoi(n)
+		if err != nil || months <= 0 {
+			return window{}, fmt.Errorf("%w: %q", errInvalidWindow, s)
+		}
+		return window{months: months}, nil
+	}
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil || days <= 0 {
+			return window{}, fmt.Errorf("%w: %q", errInvalidWindow, s)
+		}
+		return window{every: time.Duration(days) * 24 * time.Hour}, nil
+	}
+	every, err := time.ParseDuration(s)
+	if err != nil || every < time.Second {
+		return window{}, fmt.Errorf("%w: %q must be at least 1s", errInvalidWindow, s)
+	}
+	return window{every: every}, nil
+}
+
+// start returns the unix seconds of the bucket start
+// the timestamp falls into.
+func (w window) start(ts int64) int64 {
+	if w.months > 0 {
+		t := time.Unix(ts, 0).UTC()
+		// Months since year 0 floored to the window size.
+		months := int64(t.Year())*12 + int64(t.Month()-1)
+		months -= mod(months, int64(w.months))
+		return time.Date(int(months/12), time.Month(months%12+1), 1, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	every := int64(w.every / time.Second)
+	return ts - mod(ts, every)
+}
+
+// mod is always positive, so timestamps before 1970
+// are floored and not truncated towards zero.
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// parseTimestamp parses unix seconds or RFC3339 timestamp.
+func parseTimestamp(data []byte) (int64, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+	// unsafe.String is fine, the string does not outlive this call.
+	s := unsafe.String(&data[0], len(data))
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp: %q", s)
+	}
+	return t.Unix(), nil
+}
+
+// windowKeySuffix is `\x00` + 8 bytes of bucket start.
+const windowKeySuffix = 9
+
+// appendWindowKey builds the simpleMap key for (station, bucket). The
+// bucket start is big endian with flipped sign bit so that sorting keys
+// as strings sorts by station and then by time.
+func appendWindowKey(key []byte, name []byte, start int64) []byte {
+	key = append(key, name...)
+	key = append(key, 0)
+	return binary.BigEndian.AppendUint64(key, uint64(start)^(1<<63))
+}
+
+// splitWindowKey is the inverse of appendWindowKey.
+func splitWindowKey(key stationName) (stationName, int64) {
+	nameLen := len(key) - windowKeySuffix
+	start := binary.BigEndian.Uint64([]byte(key[nameLen+1:])) ^ (1 << 63)
+	return key[:nameLen], int64(start)
+}
+
+// windowChunkReader is chunkReader for lines with timestamp. The key into
+// simpleMap is (station, bucket) so sumChunk merges the same windows
+// from all of the workers.
+func windowChunkReader(chunks chan chunk, format lineFormat, w window) (simpleMap, error) {
+	var (
+		out = newSimpleMap(maxStations)
+		key = make([]byte, 0, 128)
+
+		fixedOffset = format.fixedOffset()
+		delimiter   = format.delimiter[0]
+
+		firstErr error
+	)
+
+	for chunk := range chunks {
+		// Keep draining the chunks after error, so the producer
+		// and the other workers can finish.
+		if firstErr != nil {
+			chunk.release()
+			continue
+		}
+		var (
+			chunkView = chunk.data
+
+			newlineIdx  int
+			nameAndTime stationName
+			measurement measurement
+		)
+		for {
+			if fixedOffset {
+				newlineIdx, nameAndTime, measurement = parseLine(chunkView, delimiter)
+			} else {
+				newlineIdx, nameAndTime, measurement = parseLineGeneric(chunkView, format)
+			}
+			if newlineIdx == -1 {
+				break
+			}
+
+			// The measurement parser gives us `<station>;<timestamp>` as a name.
+			line := chunkView[:len(nameAndTime)]
+			separatorIdx := bytes.LastIndex(line, format.delimiterBytes)
+			if separatorIdx == -1 {
+				firstErr = fmt.Errorf("missing timestamp in line: %q", chunkView[:newlineIdx])
+				break
+			}
+			ts, err := parseTimestamp(line[separatorIdx+len(format.delimiterBytes):])
+			if err != nil {
+				firstErr = err
+				break
+			}
+
+			key = appendWindowKey(key[:0], line[:separatorIdx], w.start(ts))
+			name := stationName(unsafe.String(&key[0], len(key)))
+
+			pos := out.pos(name)
+			stationStats, ok := out.get(pos, name)
+			if !ok {
+				stationStats = &stats{}
+				// key is reused for the next line, the map
+				// needs its own copy.
+				out.set(pos, stationName(string(key)), stationStats)
+			}
+			updateStats(stationStats, measurement)
+			// Save next line's start at current index+1 (step over \n).
+			chunkView = chunkView[newlineIdx+1:]
+		}
+		chunk.release()
+	}
+
+	return out, firstErr
+}
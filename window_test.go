@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var windowTestData = []byte(`Hamburg;2024-01-01T10:15:00Z;12.0
+Hamburg;1704104100;-3.5
+Bulawayo;2024-01-01T11:00:00+01:00;8.9
+Hamburg;2024-01-01T11:59:59Z;1.0
+Hamburg;2024-02-29T23:00:00Z;-99.9
+Bulawayo;1969-12-31T23:59:59Z;99.9
+`)
+
+func TestParseWindow(t *testing.T) {
+	w, err := parseWindow("1h")
+	require.NoError(t, err)
+	assert.Equal(t, window{every: time.Hour}, w)
+	assert.Equal(t, "1h0m0s", w.String())
+
+	w, err = parseWindow("7d")
+	require.NoError(t, err)
+	assert.Equal(t, window{every: 7 * 24 * time.Hour}, w)
+	assert.Equal(t, "7d", w.String())
+
+	w, err = parseWindow("3mo")
+	require.NoError(t, err)
+	assert.Equal(t, window{months: 3}, w)
+	assert.Equal(t, "3mo", w.String())
+
+	w, err = parseWindow("")
+	require.NoError(t, err)
+	assert.False(t, w.enabled())
+
+	for _, invalid := range []string{"0d", "-1mo", "1ms", "hour"} {
+		_, err = parseWindow(invalid)
+		assert.ErrorIs(t, err, errInvalidWindow, invalid)
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	ts := time.Date(2024, 5, 17, 13, 45, 12, 0, time.UTC).Unix()
+
+	assert.Equal(t, time.Date(2024, 5, 17, 13, 0, 0, 0, time.UTC).Unix(), window{every: time.Hour}.start(ts))
+	assert.Equal(t, time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC).Unix(), window{every: 24 * time.Hour}.start(ts))
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).Unix(), window{months: 1}.start(ts))
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC).Unix(), window{months: 3}.start(ts))
+	// Before 1970 has to floor, not truncate towards zero.
+	assert.Equal(t, int64(-3600), window{every: time.Hour}.start(-1))
+}
+
+func TestWindowKey(t *testing.T) {
+	for _, start := range []int64{-3600, 0, 1704067200} {
+		key := stationName(appendWindowKey(nil, []byte("Chișinău"), start))
+		name, gotStart := splitWindowKey(key)
+		assert.Equal(t, stationName("Chișinău"), name)
+		assert.Equal(t, start, gotStart)
+	}
+
+	// Keys sort by station and then by time.
+	a := stationName(appendWindowKey(nil, []byte("Abc"), 10))
+	b := stationName(appendWindowKey(nil, []byte("Abc"), -10))
+	c := stationName(appendWindowKey(nil, []byte("Abc d"), -10))
+	assert.Less(t, b, a)
+	assert.Less(t, a, c)
+}
+
+func TestWindowChunkReader(t *testing.T) {
+	w := window{every: time.Hour}
+	hour := func(s string) int64 {
+		ts, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return ts.Unix()
+	}
+	want := map[stationName]stats{
+		stationName(appendWindowKey(nil, []byte("Hamburg"), hour("2024-01-01T10:00:00Z"))):  {min: -35, max: 120, sum: 85, count: 2},
+		stationName(appendWindowKey(nil, []byte("Hamburg"), hour("2024-01-01T11:00:00Z"))):  {min: 10, max: 10, sum: 10, count: 1},
+		stationName(appendWindowKey(nil, []byte("Hamburg"), hour("2024-02-29T23:00:00Z"))):  {min: -999, max: -999, sum: -999, count: 1},
+		stationName(appendWindowKey(nil, []byte("Bulawayo"), hour("2024-01-01T10:00:00Z"))): {min: 89, max: 89, sum: 89, count: 1},
+		stationName(appendWindowKey(nil, []byte("Bulawayo"), hour("1969-12-31T23:00:00Z"))): {min: 999, max: 999, sum: 999, count: 1},
+	}
+
+	// Every chunk size has to produce the same result after the
+	// per-worker maps are merged.
+	for _, size := range []int{40, 64, 128, 4096} {
+		chunks := chunkByBytes(bytes.NewReader(windowTestData), size)
+		got := newSimpleMap(maxStations)
+		for c := range chunks {
+			single := make(chan chunk, 1)
+			single <- c
+			close(single)
+			out, err := windowChunkReader(single, defaultLineFormat, w)
+			require.NoError(t, err)
+			sumChunk(&got, out)
+		}
+
+		require.Equal(t, len(want), got.len(), "chunk size: %d", size)
+		for k, v := range want {
+			gotValue, ok := got.get(got.pos(k), k)
+			require.True(t, ok, "chunk size: %d, key: %q is not present in output", size, k)
+			assert.Equal(t, v, *gotValue, "chunk size: %d", size)
+		}
+	}
+}
+
+func TestWindowChunkReaderInvalidTimestamp(t *testing.T) {
+	chunks := chunkByBytes(bytes.NewReader([]byte("Hamburg;yesterday;12.0\n")), 32)
+	_, err := windowChunkReader(chunks, defaultLineFormat, window{every: time.Hour})
+	assert.ErrorContains(t, err, "invalid timestamp")
+
+	chunks = chunkByBytes(bytes.NewReader([]byte("Hamburg;12.0\n")), 32)
+	_, err = windowChunkReader(chunks, defaultLineFormat, window{every: time.Hour})
+	assert.ErrorContains(t, err, "missing timestamp")
+}